@@ -0,0 +1,194 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"sync"
+)
+
+// - the same inode can be found under several paths, as hardlinks, or through bind mounts, those entries
+// form a group in which the entry with the shortest path is canonical and all others are its aliases,
+// aliases are not shown in the results, not summed up in directory sizes and not counted in the stats,
+// they are listed in the details of their canonical entry instead
+type AliasGroup struct {
+	mutex   sync.Mutex
+	entries []*FileEntry
+}
+
+func aliasLess(a *FileEntry, b *FileEntry) bool {
+	apath, bpath := path.Join(a.Dir(), a.name), path.Join(b.Dir(), b.name)
+	if len(apath) != len(bpath) {
+		return len(apath) < len(bpath)
+	}
+	return apath < bpath
+}
+
+// - the paths of all other entries of the group, the canonical one first
+func (group *AliasGroup) Paths(except *FileEntry) []string {
+	if group == nil {
+		return nil
+	}
+
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+
+	paths := make([]string, 0, len(group.entries))
+	for _, entry := range group.entries {
+		if entry != except {
+			paths = append(paths, path.Join(entry.Dir(), entry.name))
+		}
+	}
+	return paths
+}
+
+// - bytes that are counted more than once when every entry of the group is counted
+func (group *AliasGroup) duplicateBytes() int64 {
+	var bytes int64
+	for _, entry := range group.entries[1:] {
+		bytes += entry.size
+	}
+	return bytes
+}
+
+// - wraps the column that every entry is merged into and removed from, and keeps the groups up to date
+// while entries come and go, a file that is renamed is removed and merged again, so its group is too
+type Aliases struct {
+	CrawlResult
+	mutex  sync.Mutex
+	inodes map[inodeKey]*FileEntry
+	groups map[inodeKey]*AliasGroup
+	stats  *CrawlStats
+}
+
+func NewAliases(result CrawlResult, stats *CrawlStats) *Aliases {
+	return &Aliases{
+		CrawlResult: result,
+		inodes:      make(map[inodeKey]*FileEntry),
+		groups:      make(map[inodeKey]*AliasGroup),
+		stats:       stats,
+	}
+}
+
+// - entries are grouped before they are merged, so that an alias is never visible in the results
+func (aliases *Aliases) Merge(sortcolumn SortColumn, files []*FileEntry) {
+	aliases.mutex.Lock()
+	for _, entry := range files {
+		aliases.add(entry)
+	}
+	aliases.mutex.Unlock()
+
+	aliases.CrawlResult.Merge(sortcolumn, files)
+}
+
+func (aliases *Aliases) Remove(sortcolumn SortColumn, files []*FileEntry) {
+	aliases.CrawlResult.Remove(sortcolumn, files)
+
+	aliases.mutex.Lock()
+	for _, entry := range files {
+		aliases.remove(entry)
+	}
+	aliases.mutex.Unlock()
+}
+
+func (aliases *Aliases) add(entry *FileEntry) {
+	key := inodeKey{entry.device, entry.inode}
+
+	if group, ok := aliases.groups[key]; ok {
+		aliases.update(group, func() {
+			group.entries = append(group.entries, entry)
+		})
+		entry.aliases.Store(group)
+		return
+	}
+
+	other, ok := aliases.inodes[key]
+	if !ok {
+		aliases.inodes[key] = entry
+		return
+	}
+	if other == entry {
+		return
+	}
+
+	group := &AliasGroup{}
+	aliases.update(group, func() {
+		group.entries = []*FileEntry{other, entry}
+	})
+	aliases.groups[key] = group
+	delete(aliases.inodes, key)
+	other.aliases.Store(group)
+	entry.aliases.Store(group)
+}
+
+func (aliases *Aliases) remove(entry *FileEntry) {
+	key := inodeKey{entry.device, entry.inode}
+
+	if other, ok := aliases.inodes[key]; ok {
+		if other == entry {
+			delete(aliases.inodes, key)
+		}
+		return
+	}
+
+	group, ok := aliases.groups[key]
+	if !ok {
+		return
+	}
+
+	aliases.update(group, func() {
+		for i, member := range group.entries {
+			if member == entry {
+				group.entries = append(group.entries[:i], group.entries[i+1:]...)
+				break
+			}
+		}
+	})
+	entry.aliases.Store(nil)
+
+	// - the last entry of a group is not an alias of anything anymore
+	if len(group.entries) == 1 {
+		last := group.entries[0]
+		last.aliases.Store(nil)
+		delete(aliases.groups, key)
+		aliases.inodes[key] = last
+	} else if len(group.entries) == 0 {
+		delete(aliases.groups, key)
+	}
+}
+
+// - changes the members of group, sorts them so that the canonical entry comes first, and corrects the
+// number of duplicate bytes in the stats
+func (aliases *Aliases) update(group *AliasGroup, change func()) {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+
+	var before int64
+	if len(group.entries) > 0 {
+		before = group.duplicateBytes()
+	}
+
+	change()
+	sort.Slice(group.entries, func(i, j int) bool { return aliasLess(group.entries[i], group.entries[j]) })
+
+	var after int64
+	if len(group.entries) > 0 {
+		after = group.duplicateBytes()
+	}
+	aliases.stats.Duplicates(after - before)
+}
+
+func (entry *FileEntry) AliasGroup() *AliasGroup {
+	return entry.aliases.Load()
+}
+
+// - true if entry is in a group and another entry of that group is canonical
+func (entry *FileEntry) IsAlias() bool {
+	group := entry.aliases.Load()
+	if group == nil {
+		return false
+	}
+
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+	return len(group.entries) > 0 && group.entries[0] != entry
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"runtime"
+	"time"
+
+	"testing"
+)
+
+func TestAliases(t *testing.T) {
+	now := time.Now()
+	a := &FileEntry{direntry: &DirEntry{path: "/x"}, name: "f", modtime: now, size: 100, device: 1, inode: 1, nlink: 2}
+	b := &FileEntry{direntry: &DirEntry{path: "/x/backup/daily.0"}, name: "f", modtime: now, size: 100, device: 1, inode: 1, nlink: 2}
+	c := &FileEntry{direntry: &DirEntry{path: "/y"}, name: "g", modtime: now, size: 50, device: 1, inode: 2, nlink: 1}
+	d := &FileEntry{direntry: &DirEntry{path: "/z"}, name: "g", modtime: now, size: 50, device: 2, inode: 2, nlink: 1}
+
+	stats := NewCrawlStats(nil)
+	aliases := NewAliases(NewBucket(SORT_BY_NAME, NewEntryTable()), stats)
+	files := []*FileEntry{a, b, c, d}
+	sortFileEntries(SORT_BY_NAME, files)
+	stats.Indexed(files)
+	aliases.Merge(SORT_BY_NAME, files)
+
+	if a.IsAlias() || !b.IsAlias() || c.IsAlias() || d.IsAlias() {
+		t.Error("only the longer path of the same inode should be an alias")
+	}
+	if paths := a.AliasGroup().Paths(a); len(paths) != 1 || paths[0] != "/x/backup/daily.0/f" {
+		t.Error("unexpected aliases of", a.name, paths)
+	}
+	if c.AliasGroup() != nil {
+		t.Error("same inode on another device is not an alias")
+	}
+
+	taken := takeAll(aliases, SORT_BY_NAME, DEFAULT_DIRECTION, nil, 10)
+	if len(taken) != 3 {
+		t.Error("expected aliases to be left out of the results, got", len(taken), "entries")
+	}
+	if bytes := stats.Progress(0, now).bytes; bytes != 200 {
+		t.Error("expected the bytes of the alias to be counted once, got", bytes)
+	}
+
+	// - a shorter path becomes canonical, and when the canonical entry is removed the alias takes over
+	e := &FileEntry{direntry: &DirEntry{path: "/"}, name: "f", modtime: now, size: 100, device: 1, inode: 1, nlink: 3}
+	stats.Indexed([]*FileEntry{e})
+	aliases.Merge(SORT_BY_NAME, []*FileEntry{e})
+	if e.IsAlias() || !a.IsAlias() || !b.IsAlias() {
+		t.Error("shortest path did not become canonical")
+	}
+
+	stats.Unindexed([]*FileEntry{e, a})
+	aliases.Remove(SORT_BY_NAME, []*FileEntry{e})
+	aliases.Remove(SORT_BY_NAME, []*FileEntry{a})
+	if b.IsAlias() || b.AliasGroup() != nil {
+		t.Error("last remaining entry of the inode is still an alias")
+	}
+	if bytes := stats.Progress(0, now).bytes; bytes != 200 {
+		t.Error("expected", 200, "bytes after removing aliases, got", bytes)
+	}
+
+	log.Println("TestAliases finished")
+}
+
+func TestCrawlerDedupe(t *testing.T) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// - like a backup tree made with cp -al, every file of every snapshot is a hardlink to the same inode
+	if err := ioutil.WriteFile(path.Join(root, "big"), make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, snapshot := range []string{"daily.0", "daily.1"} {
+		dir := path.Join(root, "backup", snapshot)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Link(path.Join(root, "big"), path.Join(dir, "big")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mem := NewResultMemory()
+	config := Configuration{
+		cores:         runtime.NumCPU(),
+		directories:   []string{root},
+		maxinotify:    1024,
+		recursivesize: true,
+		dedupe:        true,
+	}
+
+	crawler := startCrawler(testCrawler{mem: mem, config: config})
+	defer crawler.stop()
+
+	var found []*FileEntry
+	for _, entry := range takeAll(mem.Column(SORT_BY_SIZE), SORT_BY_SIZE, DEFAULT_DIRECTION, nil, 100) {
+		if entry.name == "big" {
+			found = append(found, entry)
+		}
+	}
+
+	if len(found) != 1 || found[0].Dir() != root {
+		t.Fatal("expected the hardlinked file once under its shortest path, got", len(found))
+	}
+	if paths := found[0].AliasGroup().Paths(found[0]); len(paths) != 2 {
+		t.Error("expected two aliases of the hardlinked file, got", paths)
+	}
+
+	rootentry := findEntry(mem, SORT_BY_NAME, path.Dir(root), path.Base(root))
+	if rootentry == nil || rootentry.RecursiveSize() != 1000 {
+		t.Error("expected the hardlinked file to be counted once in the size of", root)
+	}
+
+	log.Println("TestCrawlerDedupe finished")
+}
@@ -2,235 +2,57 @@ package main
 
 import (
 	"fmt"
+	"log"
 
 	"regexp"
 	"sync"
+	"sync/atomic"
 
-	"sort"
 	"time"
 
 	gtk "github.com/gotk3/gotk3/gtk"
 )
 
-type Threshold interface {
-	Less(than Threshold) bool
-	Equal(than Threshold) bool
-	String() string
-}
-
-type NameThreshold string
-type DirThreshold string
-type ModTimeThreshold time.Time
-type SizeThreshold int64
-
-func (a NameThreshold) Less(b Threshold) bool {
-	return a < b.(NameThreshold)
-}
-
-func (a NameThreshold) Equal(b Threshold) bool {
-	return a == b.(NameThreshold)
-}
-
-func (a NameThreshold) String() string {
-	return string(a)
-}
-
-func (a DirThreshold) Less(b Threshold) bool {
-	return a[1:] < b.(DirThreshold)[1:]
-}
-
-func (a DirThreshold) Equal(b Threshold) bool {
-	return a[1:] == b.(DirThreshold)[1:]
-}
-
-func (a DirThreshold) String() string {
-	return string(a)
-}
-
-func (a ModTimeThreshold) Less(b Threshold) bool {
-	return time.Time(a).After(time.Time(b.(ModTimeThreshold)))
-}
-
-func (a ModTimeThreshold) Equal(b Threshold) bool {
-	return time.Time(a).Equal(time.Time(b.(ModTimeThreshold)))
-}
-
-func (a ModTimeThreshold) String() string {
-	return time.Time(a).Format("2006-01-02 15:04:05")
-}
-
-func (a SizeThreshold) Less(b Threshold) bool {
-	return a > b.(SizeThreshold)
-}
-
-func (a SizeThreshold) Equal(b Threshold) bool {
-	return a == b.(SizeThreshold)
-}
-
-func (a SizeThreshold) String() string {
-	if a >= (1000 * 1000 * 1000 * 1000 * 1000) {
-		return fmt.Sprintf("%.3fP", float64(a)/(1000*1000*1000*1000*1000))
-	} else if a >= (1000 * 1000 * 1000 * 1000) {
-		return fmt.Sprintf("%.3fT", float64(a)/(1000*1000*1000*1000))
-	} else if a >= (1000 * 1000 * 1000) {
-		return fmt.Sprintf("%.3fG", float64(a)/(1000*1000*1000))
-	} else if a >= (1000 * 1000) {
-		return fmt.Sprintf("%.3fM", float64(a)/(1000*1000))
-	} else if a >= 1000 {
-		return fmt.Sprintf("%.3fK", float64(a)/1000)
-	} else {
-		return fmt.Sprintf("%db", a)
-	}
-}
-
+// - rollmutex is only used by the root of a bucket, Merge, Remove and Take hold it for reading so that Roll
+// can move entries between the children without them being merged, removed or taken at the same time
 type Node struct {
+	ordering    *Ordering
+	table       *EntryTable
 	threshold   Threshold
+	rollmutex   sync.RWMutex
 	queuemutex  sync.Mutex
 	sortedmutex sync.Mutex
-	lastchange  time.Time
-	queue       []*FileEntry
-	sorted      []*FileEntry
+	lastchange  atomic.Int64
+	queue       []EntryId
+	sorted      []EntryId
 	children    []Bucket
 }
 
 type Bucket interface {
 	Less(entry *FileEntry) bool
 	Sort(sortcolumn SortColumn)
-	AddBranch(threshold Threshold, entries []*FileEntry)
+	AddBranch(threshold Threshold, ids []EntryId)
 	ThresholdSplit(i int) Threshold
 	Node() *Node
 }
 
-func NewNameBucket() *Node {
-	bucket := new(Node)
-
-	for _, char := range "@abcdefghijklmnopqrstuvwxyz" {
-		bucket.children = append(bucket.children, &Node{
-			threshold: NameThreshold(char),
-		})
-	}
-
-	bucket.children = append(bucket.children, &Node{
-		threshold: nil,
-	})
-
-	return bucket
-}
+// - a bucket for the entries of a column, with one child for every initial threshold of its ordering,
+// and a last child without threshold for everything else, the ids stored in the bucket refer to table
+func NewBucket(sortcolumn SortColumn, table *EntryTable) *Node {
+	ordering := &orderings[sortcolumn]
+	bucket := &Node{ordering: ordering, table: table}
 
-func NewDirBucket() *Node {
-	bucket := new(Node)
-
-	var thresholds []string
-
-	//homedir := os.Getenv("HOME")
-	//thresholds = append(thresholds, "/h")
-	//thresholds = append(thresholds, path.Join(homedir, ".l"))
-	//thresholds = append(thresholds, path.Join(homedir, ".local", "s"))
-	//if _, err := os.Stat(path.Join(homedir, ".local", "share", "Zeal", "Zeal", "docsets")); err == nil {
-	//	for _, char := range "ELNOSz" {
-	//		thresholds = append(thresholds, path.Join(homedir, ".local", "share", "Zeal", "Zeal", "docsets", string(char)))
-	//	}
-	//}
-	//
-	//thresholds = append(thresholds, path.Join(homedir, ".local", "share", "z"))
-	//thresholds = append(thresholds, path.Join(homedir, ".z"))
-	//for _, char := range "Zmz" {
-	//	thresholds = append(thresholds, path.Join(homedir, string(char)))
-	//}
-	//thresholds = append(thresholds, []string{"/t", "/v", "/w"}...)
-
-	for _, char := range thresholds {
+	for _, threshold := range ordering.thresholds(time.Now()) {
 		bucket.children = append(bucket.children, &Node{
-			threshold: DirThreshold(char),
+			ordering:  ordering,
+			table:     table,
+			threshold: threshold,
 		})
 	}
 
 	bucket.children = append(bucket.children, &Node{
-		threshold: nil,
-	})
-
-	return bucket
-}
-
-func NewModTimeBucket() *Node {
-	bucket := new(Node)
-
-	now := time.Now()
-	hour := time.Hour
-	day := time.Hour * 24
-	week := day * 7
-	month := week * 4
-	year := week * 52
-	decade := year * 10
-
-	bucket.children = append(bucket.children, &Node{
-		threshold: ModTimeThreshold(now),
-	})
-
-	bucket.children = append(bucket.children, &Node{
-		threshold: ModTimeThreshold(now.Add(-hour)),
-	})
-
-	bucket.children = append(bucket.children, &Node{
-		threshold: ModTimeThreshold(now.Add(-day)),
-	})
-
-	bucket.children = append(bucket.children, &Node{
-		threshold: ModTimeThreshold(now.Add(-week)),
-	})
-
-	bucket.children = append(bucket.children, &Node{
-		threshold: ModTimeThreshold(now.Add(-month)),
-	})
-
-	bucket.children = append(bucket.children, &Node{
-		threshold: ModTimeThreshold(now.Add(-year)),
-	})
-
-	bucket.children = append(bucket.children, &Node{
-		threshold: ModTimeThreshold(now.Add(-decade)),
-	})
-
-	bucket.children = append(bucket.children, &Node{
-		threshold: nil,
-	})
-
-	return bucket
-}
-
-func NewSizeBucket() *Node {
-	bucket := new(Node)
-
-	bucket.children = append(bucket.children, &Node{
-		threshold: SizeThreshold(100000000),
-	})
-	bucket.children = append(bucket.children, &Node{
-		threshold: SizeThreshold(10000000),
-	})
-	bucket.children = append(bucket.children, &Node{
-		threshold: SizeThreshold(1000000),
-	})
-	bucket.children = append(bucket.children, &Node{
-		threshold: SizeThreshold(100000),
-	})
-	bucket.children = append(bucket.children, &Node{
-		threshold: SizeThreshold(10000),
-	})
-	// <4097 are very popular file sizes
-	bucket.children = append(bucket.children, &Node{
-		threshold: SizeThreshold(4097),
-	})
-	bucket.children = append(bucket.children, &Node{
-		threshold: SizeThreshold(1000),
-	})
-	bucket.children = append(bucket.children, &Node{
-		threshold: SizeThreshold(100),
-	})
-	bucket.children = append(bucket.children, &Node{
-		threshold: SizeThreshold(1),
-	})
-
-	bucket.children = append(bucket.children, &Node{
+		ordering:  ordering,
+		table:     table,
 		threshold: nil,
 	})
 
@@ -238,7 +60,9 @@ func NewSizeBucket() *Node {
 }
 
 func (node *Node) Merge(sortcolumn SortColumn, files []*FileEntry) {
-	Insert(sortcolumn, node, 0, files)
+	node.rollmutex.RLock()
+	defer node.rollmutex.RUnlock()
+	Insert(sortcolumn, node, 0, files, node.table.Ref(files))
 }
 
 func (node *Node) Take(cache MatchCaches, sortcolumn SortColumn, direction gtk.SortType, query *regexp.Regexp, n int, abort chan struct{}, results chan *FileEntry) {
@@ -264,6 +88,9 @@ func (node *Node) Take(cache MatchCaches, sortcolumn SortColumn, direction gtk.S
 		dircache = NewSimpleCache()
 	}
 
+	node.rollmutex.RLock()
+	defer node.rollmutex.RUnlock()
+
 	WalkNodes(node, direction, func(child Bucket) bool {
 		if child == nil {
 			results <- nil
@@ -272,11 +99,11 @@ func (node *Node) Take(cache MatchCaches, sortcolumn SortColumn, direction gtk.S
 
 		childnode := child.Node()
 
+		child.Sort(sortcolumn)
+
 		defer childnode.sortedmutex.Unlock()
 		childnode.sortedmutex.Lock()
 
-		child.Sort(sortcolumn)
-
 		sorted := childnode.sorted
 		l := len(sorted)
 
@@ -286,11 +113,11 @@ func (node *Node) Take(cache MatchCaches, sortcolumn SortColumn, direction gtk.S
 				return false
 			default:
 				index := indexfunc(l, i)
-				entry := sorted[index]
+				entry := node.table.Get(sorted[index])
 
 				matchedname, matcheddir := testMatchCaches(dircache, namecache, entry, query)
 
-				if query == nil || matchedname || matcheddir {
+				if cache.filter.Accept(entry) && (query == nil || matchedname || matcheddir) {
 					results <- entry
 					numresults += 1
 				}
@@ -307,64 +134,192 @@ func (node *Node) Take(cache MatchCaches, sortcolumn SortColumn, direction gtk.S
 }
 
 func (node *Node) Remove(sortcolumn SortColumn, files []*FileEntry) {
+	node.rollmutex.RLock()
+	defer node.rollmutex.RUnlock()
 	Delete(sortcolumn, node, 0, files)
 }
 
-func (node *Node) NumFiles() int {
-	num := 0
+// - moves the thresholds of the children of the root node to the ones that its ordering makes for now, so
+// that a bucket that was made a week ago still has a child for the last hour, entries that are not between
+// the new thresholds of their child anymore are moved to the child they belong to now
+// - only the few entries at the ends of each child are looked at, they are removed and merged again like
+// any other change, Merge, Remove and Take wait until that is done, the children that were split keep
+// their subtrees, minus the nodes that were emptied by moving their entries away
+// - returns how many entries were moved, orderings whose thresholds do not depend on now move nothing
+func (node *Node) Roll(sortcolumn SortColumn, now time.Time) int {
+	node.rollmutex.Lock()
+	defer node.rollmutex.Unlock()
+
+	thresholds := append(node.ordering.thresholds(now), nil)
+	if len(thresholds) != len(node.children) {
+		log.Println("can not roll bucket with", len(node.children), "children to", len(thresholds), "thresholds")
+		return 0
+	}
+
+	changed := false
+	for i, child := range node.children {
+		childnode := child.Node()
+		childnode.queuemutex.Lock()
+		changed = changed || !node.ordering.Equal(childnode.threshold, thresholds[i])
+		childnode.queuemutex.Unlock()
+	}
+	if !changed {
+		return 0
+	}
+
+	// - entries at the front of a child belong to a child before it when the thresholds moved up, the ones
+	// at the back belong to a child after it when they moved down
+	var moving []*FileEntry
+	for i, child := range node.children {
+		child.Sort(sortcolumn)
+
+		if i > 0 {
+			WalkEntries(child, gtk.SORT_ASCENDING, func(entry *FileEntry) bool {
+				if entry == nil || !node.ordering.Below(entry, thresholds[i-1]) {
+					return false
+				}
+				moving = append(moving, entry)
+				return true
+			})
+		}
+
+		WalkEntries(child, gtk.SORT_DESCENDING, func(entry *FileEntry) bool {
+			if entry == nil || node.ordering.Below(entry, thresholds[i]) {
+				return false
+			}
+			moving = append(moving, entry)
+			return true
+		})
+	}
+
+	// - the entries have to be removed while the old thresholds still lead to them, and merged after the
+	// new ones are in place
+	sortFileEntries(sortcolumn, moving)
+	ids := node.table.Ref(moving)
+	Delete(sortcolumn, node, 0, moving)
+	for i, child := range node.children {
+		setThreshold(child, thresholds[i])
+	}
+	Insert(sortcolumn, node, 0, moving, ids)
 	for _, child := range node.children {
-		num += child.(*Node).NumFiles()
+		collapse(child)
 	}
-	num += len(node.queue)
-	num += len(node.sorted)
-	return num
+
+	return len(moving)
 }
 
-func (node *Node) Less(entry *FileEntry) bool {
-	if node.threshold != nil {
-		switch node.threshold.(type) {
-		case NameThreshold:
-			return NameThreshold(entry.name).Less(node.threshold)
-		case DirThreshold:
-			return DirThreshold(entry.dir).Less(node.threshold)
-		case ModTimeThreshold:
-			return ModTimeThreshold(entry.modtime).Less(node.threshold)
-		case SizeThreshold:
-			return SizeThreshold(entry.size).Less(node.threshold)
+// - removes the nodes below bucket that have no entries left, the last child of a node is kept because it
+// has the threshold of the node, a node that is left with only its last child takes over its entries and
+// children, so that rolling entries through a split child does not make its subtree deeper and deeper
+func collapse(bucket Bucket) {
+	node := bucket.Node()
+
+	node.queuemutex.Lock()
+	children := node.children
+	node.queuemutex.Unlock()
+
+	if len(children) == 0 {
+		return
+	}
+
+	for _, child := range children {
+		collapse(child)
+	}
+
+	node.queuemutex.Lock()
+	defer node.queuemutex.Unlock()
+	node.sortedmutex.Lock()
+	defer node.sortedmutex.Unlock()
+
+	var kept []Bucket
+	for i, child := range node.children {
+		if i == len(node.children)-1 || child.Node().NumFiles() > 0 {
+			kept = append(kept, child)
 		}
 	}
 
-	return true
+	if len(kept) > 1 {
+		node.children = kept
+		return
+	}
+
+	last := kept[0].Node()
+	last.queuemutex.Lock()
+	last.sortedmutex.Lock()
+	node.queue = append(node.queue, last.queue...)
+	node.sorted = last.sorted
+	node.children = last.children
+	last.sortedmutex.Unlock()
+	last.queuemutex.Unlock()
 }
 
-func (node *Node) Sort(sortcolumn SortColumn) {
-	if len(node.queue) > 0 {
-		switch sortcolumn {
-		case SORT_BY_NAME:
-			sort.Stable(SortedByName(node.queue))
-		case SORT_BY_DIR:
-			sort.Stable(SortedByDir(node.queue))
-		case SORT_BY_MODTIME:
-			sort.Stable(SortedByModTime(node.queue))
-		case SORT_BY_SIZE:
-			sort.Stable(SortedBySize(node.queue))
-		}
-		node.sorted = sortMerge(sortcolumn, node.sorted, node.queue)
-		node.queue = node.queue[:0]
+// - the last child of a node that was split always has the threshold of its parent, so it is moved
+// together with it
+func setThreshold(bucket Bucket, threshold Threshold) {
+	node := bucket.Node()
+
+	node.queuemutex.Lock()
+	node.threshold = threshold
+	children := node.children
+	node.queuemutex.Unlock()
+
+	if len(children) > 0 {
+		setThreshold(children[len(children)-1], threshold)
 	}
+}
 
-	for _, child := range node.children {
+func (node *Node) NumFiles() int {
+	node.queuemutex.Lock()
+	node.sortedmutex.Lock()
+	num := len(node.queue) + len(node.sorted)
+	children := node.children
+	node.sortedmutex.Unlock()
+	node.queuemutex.Unlock()
+
+	for _, child := range children {
+		num += child.Node().NumFiles()
+	}
+	return num
+}
+
+func (node *Node) Less(entry *FileEntry) bool {
+	return node.ordering.Below(entry, node.threshold)
+}
+
+// - merges the queues of node and of all nodes below it into their sorted slices, Sort locks every node
+// itself while doing so, queuemutex before sortedmutex like everywhere else, so callers must not hold
+// either of them
+func (node *Node) Sort(sortcolumn SortColumn) {
+	node.queuemutex.Lock()
+	node.sortedmutex.Lock()
+	node.sortQueue(sortcolumn)
+	children := node.children
+	node.sortedmutex.Unlock()
+	node.queuemutex.Unlock()
+
+	for _, child := range children {
 		child.Sort(sortcolumn)
 	}
 }
 
-func (node *Node) AddBranch(threshold Threshold, entries []*FileEntry) {
+// - the part of Sort for node alone, for callers that already hold both of its mutexes
+func (node *Node) sortQueue(sortcolumn SortColumn) {
+	if len(node.queue) > 0 {
+		sortEntryIds(node.table, sortcolumn, node.queue)
+		node.sorted = sortMergeIds(node.table, sortcolumn, node.sorted, node.queue)
+		node.queue = nil
+	}
+}
+
+func (node *Node) AddBranch(threshold Threshold, ids []EntryId) {
 	newnode := &Node{
-		threshold:  threshold,
-		lastchange: time.Now(),
-		sorted:     make([]*FileEntry, len(entries)),
+		ordering:  node.ordering,
+		table:     node.table,
+		threshold: threshold,
+		sorted:    make([]EntryId, len(ids)),
 	}
-	copy(newnode.sorted, entries)
+	newnode.touch()
+	copy(newnode.sorted, ids)
 	node.children = append(node.children, newnode)
 }
 
@@ -373,24 +328,23 @@ func (node *Node) ThresholdSplit(i int) Threshold {
 		return node.threshold
 	}
 
-	switch node.threshold.(type) {
-	case NameThreshold:
-		return NameThreshold(node.sorted[i].name)
-	case DirThreshold:
-		return DirThreshold(node.sorted[i].dir)
-	case ModTimeThreshold:
-		return ModTimeThreshold(node.sorted[i].modtime)
-	case SizeThreshold:
-		return SizeThreshold(node.sorted[i].size)
-	}
-
-	return node.threshold
+	return entryThreshold(node.table.Get(node.sorted[i]))
 }
 
 func (node *Node) Node() *Node {
 	return node
 }
 
+// - the root of a bucket is changed by every Merge and Remove without any of the node mutexes, so the
+// time of the last change is kept as an atomic
+func (node *Node) touch() {
+	node.lastchange.Store(time.Now().UnixNano())
+}
+
+func (node *Node) LastChange() time.Time {
+	return time.Unix(0, node.lastchange.Load())
+}
+
 func WalkEntries(bucket Bucket, direction gtk.SortType, f func(entry *FileEntry) bool) bool {
 	return WalkEntriesRecur(nil, bucket, direction, f)
 }
@@ -417,25 +371,32 @@ func WalkEntriesRecur(parent Bucket, bucket Bucket, direction gtk.SortType, f fu
 				}
 				node.queuemutex.Lock()
 			} else {
-				sorted := child.(*Node).sorted
+				childnode := child.Node()
+				childnode.sortedmutex.Lock()
+				sorted := childnode.sorted
 				for j := range sorted {
-					entry := sorted[indexfunc(len(sorted), j)]
+					entry := node.table.Get(sorted[indexfunc(len(sorted), j)])
 					if !f(entry) {
+						childnode.sortedmutex.Unlock()
 						node.queuemutex.Unlock()
 						return false
 					}
 				}
+				childnode.sortedmutex.Unlock()
 			}
 		}
 	} else {
+		node.sortedmutex.Lock()
 		sorted := node.sorted
 		for j := range sorted {
-			entry := sorted[indexfunc(len(sorted), j)]
+			entry := node.table.Get(sorted[indexfunc(len(sorted), j)])
 			if !f(entry) {
+				node.sortedmutex.Unlock()
 				node.queuemutex.Unlock()
 				return false
 			}
 		}
+		node.sortedmutex.Unlock()
 	}
 
 	ret := true
@@ -500,25 +461,17 @@ func PrintBucket(bucket Bucket, level int) {
 		childnode := child.Node()
 
 		if level < 0 {
-			if childnode.threshold == nil {
-				fmt.Println("maximum", "numfiles:", childnode.NumFiles())
-			} else {
-				fmt.Println(childnode.threshold.String(), "numfiles:", childnode.NumFiles())
-			}
+			fmt.Println(childnode.ordering.Format(childnode.threshold), "numfiles:", childnode.NumFiles())
 		} else {
 			for i := 0; i < level; i++ {
 				fmt.Print(" ")
 			}
 
 			if len(childnode.children) > 0 {
-				fmt.Println("parent:", childnode.threshold, "numfiles:", childnode.NumFiles())
+				fmt.Println("parent:", childnode.ordering.Format(childnode.threshold), "numfiles:", childnode.NumFiles())
 				PrintBucket(child, level+1)
 			} else {
-				if childnode.threshold == nil {
-					fmt.Println("maximum", "numfiles:", len(childnode.queue)+len(childnode.sorted))
-				} else {
-					fmt.Println(childnode.threshold.String(), "numfiles:", len(childnode.queue)+len(childnode.sorted))
-				}
+				fmt.Println(childnode.ordering.Format(childnode.threshold), "numfiles:", len(childnode.queue)+len(childnode.sorted))
 			}
 		}
 
@@ -526,13 +479,15 @@ func PrintBucket(bucket Bucket, level int) {
 }
 
 const (
-	SPLIT_ENTRYTHRESHOLD int = 10000
-	SPLIT_NUMPARTS       int = 10
+	SPLIT_ENTRYTHRESHOLD int           = 10000
+	SPLIT_NUMPARTS       int           = 10
+	ROLL_INTERVAL        time.Duration = time.Minute
 )
 
-func Insert(sortcolumn SortColumn, bucket Bucket, first int, files []*FileEntry) int {
+// - ids are the ids of files in the table of bucket, the caller got them with Ref
+func Insert(sortcolumn SortColumn, bucket Bucket, first int, files []*FileEntry, ids []EntryId) int {
 	node := bucket.Node()
-	node.lastchange = time.Now()
+	node.touch()
 
 	i := first
 childrenloop:
@@ -543,10 +498,10 @@ childrenloop:
 
 		for i < len(files) && child.Less(files[i]) {
 			if len(childnode.children) > 0 {
-				i = Insert(sortcolumn, child, i, files)
+				i = Insert(sortcolumn, child, i, files, ids)
 			} else {
-				childnode.lastchange = time.Now()
-				childnode.queue = append(childnode.queue, files[i])
+				childnode.touch()
+				childnode.queue = append(childnode.queue, ids[i])
 				i += 1
 			}
 		}
@@ -568,73 +523,48 @@ childrenloop:
 
 func Delete(sortcolumn SortColumn, bucket Bucket, first int, files []*FileEntry) int {
 	node := bucket.Node()
-	node.lastchange = time.Now()
-
-	searchfunc := func(a, b *FileEntry) bool {
-		aname := NameThreshold(a.name)
-		bname := NameThreshold(b.name)
-		adir := DirThreshold(a.dir)
-		bdir := DirThreshold(b.dir)
-
-		switch sortcolumn {
-		case SORT_BY_NAME:
-			return !aname.Less(bname) || (aname.Equal(bname) && adir.Equal(bdir))
-		case SORT_BY_DIR:
-			return !adir.Less(bdir) || (aname.Equal(bname) && adir.Equal(bdir))
-		case SORT_BY_MODTIME:
-			amodtime := ModTimeThreshold(a.modtime)
-			bmodtime := ModTimeThreshold(b.modtime)
-			return (amodtime.Equal(bmodtime) || !amodtime.Less(bmodtime)) || (aname.Equal(bname) && adir.Equal(bdir))
-		case SORT_BY_SIZE:
-			asize := SizeThreshold(a.size)
-			bsize := SizeThreshold(b.size)
-			return (asize.Equal(bsize) || !asize.Less(bsize)) || (aname.Equal(bname) && adir.Equal(bdir))
-		}
-
-		return true
-	}
+	node.touch()
 
 	i := first
 childrenloop:
 	for _, child := range node.children {
 		childnode := child.Node()
 
-		childnode.queuemutex.Lock()
 		child.Sort(sortcolumn)
-		childnode.queuemutex.Unlock()
 
 		childnode.sortedmutex.Lock()
-		start := 0
-		newsorted := childnode.sorted[:0]
+		// - entries are only marked for removal while searching, because files may contain
+		// entries that compare equal but are in a different order then in childnode.sorted, so
+		// we can't just copy everything up to the found index and continue searching after it,
+		// with total orderings that only happens when the same file was merged more then once
+		removed := make(map[int]bool)
 		for i < len(files) && child.Less(files[i]) {
 			if len(childnode.children) > 0 {
 				i = Delete(sortcolumn, child, i, files)
 			} else {
-				n := len(childnode.sorted) - start
-				amount := sort.Search(n, func(testindex int) bool {
-					a := childnode.sorted[start+testindex]
-					b := files[i]
-					ret := searchfunc(a, b)
-					return ret
-				})
-
-				if amount == n {
-					panic("this should not happen")
+				index := searchFileEntry(node.table, sortcolumn, childnode.sorted, files[i], removed)
+				if index >= 0 {
+					removed[index] = true
 				}
-
-				if amount >= 0 {
-					childnode.lastchange = time.Now()
-					newsorted = append(newsorted, childnode.sorted[start:start+amount]...)
-				}
-
-				start += amount + 1
 				i += 1
 			}
 		}
 
-		if start > 0 {
-			newsorted = append(newsorted, childnode.sorted[start:len(childnode.sorted)]...)
+		// - only the ids that were found here are given back to the table, files that were not in this
+		// column keep their ids for the columns that still store them
+		if len(removed) > 0 {
+			childnode.touch()
+			released := make([]EntryId, 0, len(removed))
+			newsorted := childnode.sorted[:0]
+			for j, id := range childnode.sorted {
+				if removed[j] {
+					released = append(released, id)
+				} else {
+					newsorted = append(newsorted, id)
+				}
+			}
 			childnode.sorted = newsorted
+			node.table.Unref(released)
 		}
 		childnode.sortedmutex.Unlock()
 
@@ -650,7 +580,7 @@ func Split(sortcolumn SortColumn, bucket Bucket, numparts int) {
 	// - we want to split this node.sorted slice into numparts parts and create a childnode
 	// in node.children for each of them
 	node := bucket.Node()
-	node.lastchange = time.Now()
+	node.touch()
 
 	// - its an expensive operation, so we only do it when we have to, in node.queue we accumulate
 	// entries and split once we have enough entries accumulated (this check is done outside of this
@@ -667,8 +597,9 @@ func Split(sortcolumn SortColumn, bucket Bucket, numparts int) {
 	}
 
 	// - sorted is already sorted, but queue is just appended to, so we sort queue and then merge
-	// sorted and queue, afterwards we can discard the queue
-	bucket.Sort(sortcolumn)
+	// sorted and queue, afterwards we can discard the queue, Insert holds both mutexes of node while
+	// it splits it
+	node.sortQueue(sortcolumn)
 
 	// - below is an algorithm that tries to split the sorted slice into roughly uniform parts,
 	// the general idea is that we can use the entries in the slice itself as new thresholds for
@@ -679,6 +610,7 @@ func Split(sortcolumn SortColumn, bucket Bucket, numparts int) {
 	// - endthreshold is needed to decide if entries are the same as the last entry, meaning there is
 	// no other threshold to be found among the entries at which the sorted slice can be split and we can
 	// just put all those entries in a child and finish
+	ordering := node.ordering
 	endthreshold := bucket.ThresholdSplit(len(node.sorted) - 1)
 
 	// - we compute inc with which we can increase an index numparts times and split
@@ -689,9 +621,13 @@ func Split(sortcolumn SortColumn, bucket Bucket, numparts int) {
 	// slice is pointless and just return, not doing so would result in a very unbalanced subtree
 	// with nodes containing very few entries and then one node containing almost all of them which
 	// would be further divided, resulting in a very deep subtree
+	// - since ThresholdSplit returns entries and every ordering ends with the path of the entries, two
+	// thresholds are only equal when they are made from entries with the same path, so lots of entries
+	// with the same size are split up like any other entries, the edge cases are still handled for
+	// entries that were merged twice
 	inc := len(node.sorted) / numparts
 	incthreshold := bucket.ThresholdSplit(inc)
-	if (incthreshold != nil && incthreshold.Equal(endthreshold)) || (incthreshold == nil && endthreshold == nil) {
+	if ordering.Equal(incthreshold, endthreshold) {
 		return
 	}
 
@@ -720,21 +656,21 @@ func Split(sortcolumn SortColumn, bucket Bucket, numparts int) {
 		// entries size at the b index is already not less then endthreshold
 		// - I leave it in because it works, but the resulting subtree is quite unbalanced as well,
 		// the above early return is simpler and seems to be better
-		// if i < numparts-1 && !bucket.Threshold(b).Less(endthreshold) {
+		// if i < numparts-1 && !ordering.LessThreshold(bucket.ThresholdSplit(b), endthreshold) {
 		// 	b = a + 1
 		// }
 
 		// - to make sure that the b index seperates two slice parts such that there are no entries
 		// with equal size that end up in both resulting parts, we increase b when the sizes of the
 		// entries at b-1 and b are not less, until they are
-		for b < len(node.sorted) && (!bucket.ThresholdSplit(b - 1).Less(bucket.ThresholdSplit(b))) {
+		for b < len(node.sorted) && !ordering.LessThreshold(bucket.ThresholdSplit(b-1), bucket.ThresholdSplit(b)) {
 			b += 1
 		}
 
 		// - if we are in the last loop iteration, or if all remaining entries have the same size as
 		// the last entry, then we set b to len(node.sorted) so that all remaining entries end up
 		// in the last part
-		if b < len(node.sorted) && (i == numparts-1 || !bucket.ThresholdSplit(b).Less(endthreshold)) {
+		if b < len(node.sorted) && (i == numparts-1 || !ordering.LessThreshold(bucket.ThresholdSplit(b), endthreshold)) {
 			b = len(node.sorted)
 		}
 
@@ -1,7 +1,8 @@
 package main
 
 import (
-	//"fmt"
+	"context"
+	"fmt"
 	"log"
 	"os"
 	//"time"
@@ -9,6 +10,7 @@ import (
 	"regexp"
 	"runtime"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,12 +23,7 @@ import (
 func TestBuckets(t *testing.T) {
 	log.Println("running TestBuckets")
 
-	mem := ResultMemory{
-		NewNameBucket(),
-		NewDirBucket(),
-		NewModTimeBucket(),
-		NewSizeBucket(),
-	}
+	mem := NewResultMemory()
 	config := Configuration{
 		cores:       runtime.NumCPU(),
 		directories: []string{os.Getenv("HOME"), "/usr", "/var", "/sys", "/opt", "/etc", "/bin", "/sbin"},
@@ -36,21 +33,13 @@ func TestBuckets(t *testing.T) {
 		config.directories = []string{os.Getenv("HOME")}
 	}
 
-	newdirs := make(chan string)
-	crawlerquery := make(chan *regexp.Regexp)
-	var wg sync.WaitGroup
-
 	log.Println("starting Crawl on", config.cores, "cores")
-	finish := make(chan struct{})
-	wg.Add(1)
-	go Crawler(&wg, mem, config, newdirs, crawlerquery, finish)
-	wg.Wait()
-	close(finish)
+	startCrawler(testCrawler{mem: mem, config: config}).stop()
 	log.Println("Crawl terminated")
 
 	searchterm := ".*\\.cc$"
 	query, _ := regexp.Compile(searchterm)
-	cache := MatchCaches{NewSimpleCache(), NewSimpleCache()}
+	cache := MatchCaches{NewSimpleCache(), NewSimpleCache(), FILTER_ALL}
 	abort := make(chan struct{})
 	taken := make(chan *FileEntry)
 
@@ -67,28 +56,28 @@ func TestBuckets(t *testing.T) {
 	}
 
 	go taker(&byname)
-	mem.byname.Take(cache, SORT_BY_NAME, gtk.SORT_ASCENDING, query, 1000, abort, taken)
+	mem.columns[SORT_BY_NAME].Take(cache, SORT_BY_NAME, gtk.SORT_ASCENDING, query, 1000, abort, taken)
 
 	go taker(&bydir)
-	mem.bydir.Take(cache, SORT_BY_DIR, gtk.SORT_ASCENDING, query, 1000, abort, taken)
+	mem.columns[SORT_BY_DIR].Take(cache, SORT_BY_DIR, gtk.SORT_ASCENDING, query, 1000, abort, taken)
 
 	go taker(&bymodtime)
-	mem.bymodtime.Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, query, 1000, abort, taken)
+	mem.columns[SORT_BY_MODTIME].Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, query, 1000, abort, taken)
 
 	go taker(&bysize)
-	mem.bysize.Take(cache, SORT_BY_SIZE, gtk.SORT_ASCENDING, query, 1000, abort, taken)
+	mem.columns[SORT_BY_SIZE].Take(cache, SORT_BY_SIZE, gtk.SORT_ASCENDING, query, 1000, abort, taken)
 
-	log.Println("len(byname):", len(byname), mem.byname.NumFiles())
-	PrintBucket(mem.byname.(*Node), -1)
-	log.Println("len(bydir):", len(bydir), mem.bydir.NumFiles())
-	PrintBucket(mem.bydir.(*Node), -1)
-	log.Println("len(bymodtime):", len(bymodtime), mem.bymodtime.NumFiles())
-	PrintBucket(mem.bymodtime.(*Node), -1)
-	log.Println("len(bysize):", len(bysize), mem.bysize.NumFiles())
-	PrintBucket(mem.bysize.(*Node), -1)
+	log.Println("len(byname):", len(byname), mem.columns[SORT_BY_NAME].NumFiles())
+	PrintBucket(mem.columns[SORT_BY_NAME].(*Node), -1)
+	log.Println("len(bydir):", len(bydir), mem.columns[SORT_BY_DIR].NumFiles())
+	PrintBucket(mem.columns[SORT_BY_DIR].(*Node), -1)
+	log.Println("len(bymodtime):", len(bymodtime), mem.columns[SORT_BY_MODTIME].NumFiles())
+	PrintBucket(mem.columns[SORT_BY_MODTIME].(*Node), -1)
+	log.Println("len(bysize):", len(bysize), mem.columns[SORT_BY_SIZE].NumFiles())
+	PrintBucket(mem.columns[SORT_BY_SIZE].(*Node), -1)
 
 	var lastentry *FileEntry
-	WalkEntries(mem.bymodtime.(*Node), gtk.SORT_ASCENDING, func(entry *FileEntry) bool {
+	WalkEntries(mem.columns[SORT_BY_MODTIME].(*Node), gtk.SORT_ASCENDING, func(entry *FileEntry) bool {
 		if entry == nil {
 			return true
 		}
@@ -97,7 +86,7 @@ func TestBuckets(t *testing.T) {
 			lastentry = entry
 			return true
 		} else {
-			if ModTimeThreshold(entry.modtime).Less(ModTimeThreshold(lastentry.modtime)) {
+			if lessFileEntries(SORT_BY_MODTIME, entry, lastentry) {
 				t.Error("ModTimeBucket Walk could not assert ASCENDING sorting")
 				return false
 			}
@@ -107,7 +96,7 @@ func TestBuckets(t *testing.T) {
 	})
 
 	lastentry = nil
-	WalkEntries(mem.bydir.(*Node), gtk.SORT_DESCENDING, func(entry *FileEntry) bool {
+	WalkEntries(mem.columns[SORT_BY_DIR].(*Node), gtk.SORT_DESCENDING, func(entry *FileEntry) bool {
 		if entry == nil {
 			return true
 		}
@@ -116,7 +105,7 @@ func TestBuckets(t *testing.T) {
 			lastentry = entry
 			return true
 		} else {
-			if DirThreshold(lastentry.dir).Less(DirThreshold(entry.dir)) {
+			if lessFileEntries(SORT_BY_DIR, lastentry, entry) {
 				t.Error("DirBucket Walk could not assert DESCENDING sorting")
 				return false
 			}
@@ -125,14 +114,14 @@ func TestBuckets(t *testing.T) {
 		return true
 	})
 
-	WalkNodes(mem.bysize.(*Node), gtk.SORT_ASCENDING, func(child Bucket) bool {
+	WalkNodes(mem.columns[SORT_BY_SIZE].(*Node), gtk.SORT_ASCENDING, func(child Bucket) bool {
 		if child == nil {
 			return true
 		}
 
 		node := child.Node()
 
-		if !sort.IsSorted(SortedBySize(node.sorted)) {
+		if !sort.IsSorted(SortedIds{mem.table.Less(SORT_BY_SIZE), node.sorted}) {
 			t.Error("Found a node.sorted that is not sorted")
 			return false
 		}
@@ -142,76 +131,320 @@ func TestBuckets(t *testing.T) {
 			return false
 		}
 
-		for _, entry := range node.sorted {
-			if node.threshold != nil {
-				if !SizeThreshold(entry.size).Less(node.threshold) {
-					t.Error("Found an entry.size that is not less then its threshold")
-					return false
-				}
+		for _, id := range node.sorted {
+			if !orderings[SORT_BY_SIZE].Below(mem.table.Get(id), node.threshold) {
+				t.Error("Found an entry.size that is not less then its threshold")
+				return false
 			}
 		}
 		return true
 	})
 
+	lastentry = nil
+	WalkEntries(mem.columns[SORT_BY_EXTENSION].(*Node), gtk.SORT_ASCENDING, func(entry *FileEntry) bool {
+		if entry == nil {
+			return true
+		}
+
+		if lastentry != nil && lessFileEntries(SORT_BY_EXTENSION, entry, lastentry) {
+			t.Error("ExtensionBucket Walk could not assert ASCENDING sorting")
+			return false
+		}
+		lastentry = entry
+		return true
+	})
+
 	log.Println("TestBuckets finished")
 }
 
+func TestExtensionBucket(t *testing.T) {
+	// - enough files with the same first letter of their extension to split the bucket of that letter
+	var files []*FileEntry
+	now := time.Now()
+	for i := 0; i < 6*(SPLIT_ENTRYTHRESHOLD/3); i++ {
+		ext := []string{"iso", "ISO", "img", "ini", "c", ""}[i%6]
+		name := fmt.Sprintf("%d", i)
+		if ext != "" {
+			name += "." + ext
+		}
+		files = append(files, &FileEntry{direntry: &DirEntry{path: "/x"}, name: name, modtime: now, size: int64(i)})
+	}
+
+	bucket := NewBucket(SORT_BY_EXTENSION, NewEntryTable())
+	sortFileEntries(SORT_BY_EXTENSION, files)
+	bucket.Merge(SORT_BY_EXTENSION, files)
+	if bucket.NumFiles() != len(files) {
+		t.Fatal("expected", len(files), "files in bucket, got", bucket.NumFiles())
+	}
+
+	var removed []*FileEntry
+	for _, entry := range files {
+		if extension(entry.name) == "ini" {
+			removed = append(removed, entry)
+		}
+	}
+	bucket.Remove(SORT_BY_EXTENSION, removed)
+	// - the child with threshold j has all extensions that start with i
+	if len(bucket.children[10].Node().children) == 0 {
+		t.Error("expected the bucket for extensions starting with i to be split")
+	}
+
+	counts := make(map[string]int)
+	var lastentry *FileEntry
+	WalkEntries(bucket, gtk.SORT_ASCENDING, func(entry *FileEntry) bool {
+		if entry == nil {
+			return true
+		}
+		if lastentry != nil && lessFold(extension(entry.name), extension(lastentry.name)) {
+			t.Error("not sorted by extension:", lastentry.name, "before", entry.name)
+			return false
+		}
+		counts[strings.ToLower(extension(entry.name))] += 1
+		lastentry = entry
+		return true
+	})
+
+	if counts["ini"] != 0 || counts["iso"] != len(files)/3 || counts["img"] != len(files)/6 || counts[""] != len(files)/6 {
+		t.Error("unexpected number of files per extension:", counts)
+	}
+
+	log.Println("TestExtensionBucket finished")
+}
+
+func TestSplitEqualKeys(t *testing.T) {
+	// - files from an extracted archive, all with the same size and modtime
+	var files []*FileEntry
+	now := time.Now()
+	for i := 0; i < 2*SPLIT_ENTRYTHRESHOLD; i++ {
+		files = append(files, &FileEntry{direntry: &DirEntry{path: fmt.Sprintf("/x/%d", i%7)}, name: fmt.Sprintf("%d", i), modtime: now, size: 4096})
+	}
+
+	bucket := NewBucket(SORT_BY_SIZE, NewEntryTable())
+	sorted := make([]*FileEntry, len(files))
+	copy(sorted, files)
+	sortFileEntries(SORT_BY_SIZE, sorted)
+	bucket.Merge(SORT_BY_SIZE, sorted)
+
+	// - the child with threshold 1000 has everything from 1000 to 4096
+	if len(bucket.children[6].Node().children) < 2 {
+		t.Error("expected entries with equal sizes to be split by their path")
+	}
+
+	var removed []*FileEntry
+	for i, entry := range sorted {
+		if i%3 == 0 {
+			removed = append(removed, entry)
+		}
+	}
+	bucket.Remove(SORT_BY_SIZE, removed)
+	if bucket.NumFiles() != len(files)-len(removed) {
+		t.Error("expected", len(files)-len(removed), "files after removing, got", bucket.NumFiles())
+	}
+
+	var lastentry *FileEntry
+	WalkEntries(bucket, gtk.SORT_ASCENDING, func(entry *FileEntry) bool {
+		if entry == nil {
+			return true
+		}
+		if lastentry != nil && !lessFileEntries(SORT_BY_SIZE, lastentry, entry) {
+			t.Error("entries with equal sizes are not ordered by path:", lastentry.Dir(), lastentry.name, "before", entry.Dir(), entry.name)
+			return false
+		}
+		lastentry = entry
+		return true
+	})
+
+	log.Println("TestSplitEqualKeys finished")
+}
+
+func TestRollModTime(t *testing.T) {
+	// - the clock starts long before the bucket was made, so the first roll moves the thresholds up and
+	// every day after that moves them down
+	clock := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	var files []*FileEntry
+	for i := 0; i < 3*SPLIT_ENTRYTHRESHOLD; i++ {
+		files = append(files, &FileEntry{direntry: &DirEntry{path: fmt.Sprintf("/x/%d", i%7)}, name: fmt.Sprintf("%d", i), modtime: clock.Add(-time.Duration(i) * 30 * time.Minute)})
+	}
+	sortFileEntries(SORT_BY_MODTIME, files)
+
+	bucket := NewBucket(SORT_BY_MODTIME, NewEntryTable())
+	bucket.Merge(SORT_BY_MODTIME, files)
+
+	ordering := &orderings[SORT_BY_MODTIME]
+	checkChildren := func(day int) {
+		thresholds := append(ordering.thresholds(clock), nil)
+		for i, child := range bucket.children {
+			if !ordering.Equal(child.Node().threshold, thresholds[i]) {
+				t.Error("day", day, "child", i, "has threshold", ordering.Format(child.Node().threshold), "instead of", ordering.Format(thresholds[i]))
+			}
+			WalkEntries(child, gtk.SORT_ASCENDING, func(entry *FileEntry) bool {
+				if entry == nil {
+					return true
+				}
+				if !ordering.Below(entry, thresholds[i]) || (i > 0 && ordering.Below(entry, thresholds[i-1])) {
+					t.Error("day", day, "child", i, "contains", entry.name, "modified at", entry.modtime)
+					return false
+				}
+				return true
+			})
+		}
+
+		if bucket.NumFiles() != len(files) {
+			t.Error("day", day, "expected", len(files), "files, got", bucket.NumFiles())
+		}
+
+		var lastentry *FileEntry
+		WalkEntries(bucket, gtk.SORT_ASCENDING, func(entry *FileEntry) bool {
+			if entry == nil {
+				return true
+			}
+			if lastentry != nil && !lessFileEntries(SORT_BY_MODTIME, lastentry, entry) {
+				t.Error("day", day, "entries out of order:", lastentry.modtime, "before", entry.modtime)
+				return false
+			}
+			lastentry = entry
+			return true
+		})
+	}
+
+	if bucket.Roll(SORT_BY_MODTIME, clock) == 0 {
+		t.Error("expected entries to move when the thresholds are moved up")
+	}
+	checkChildren(0)
+
+	// - Take goes on while the days pass, it waits while entries are moved and always sees all of them in order
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			taken := takeAll(bucket, SORT_BY_MODTIME, gtk.SORT_ASCENDING, nil, 100)
+			for i := 1; i < len(taken); i++ {
+				if !lessFileEntries(SORT_BY_MODTIME, taken[i-1], taken[i]) {
+					t.Error("took entries out of order:", taken[i-1].modtime, "before", taken[i].modtime)
+					return
+				}
+			}
+		}
+	}()
+
+	for day := 1; day <= 14; day++ {
+		clock = clock.Add(24 * time.Hour)
+
+		// - a file that was changed a few minutes ago and one that was changed this morning
+		changed := []*FileEntry{
+			{direntry: &DirEntry{path: "/y"}, name: fmt.Sprintf("minutes%d", day), modtime: clock.Add(-10 * time.Minute)},
+			{direntry: &DirEntry{path: "/y"}, name: fmt.Sprintf("morning%d", day), modtime: clock.Add(-5 * time.Hour)},
+		}
+		files = append(files, changed...)
+		bucket.Merge(SORT_BY_MODTIME, changed)
+
+		if bucket.Roll(SORT_BY_MODTIME, clock) == 0 {
+			t.Error("day", day, "expected entries to move")
+		}
+		checkChildren(day)
+
+		// - only the file from a few minutes ago is from the last hour, the one from the morning is from
+		// the last day with the ones from yesterday gone to the last week
+		if n := bucket.children[1].Node().NumFiles(); n != 1 {
+			t.Error("day", day, "expected one file from the last hour, got", n)
+		}
+		if n := bucket.children[2].Node().NumFiles(); n != 1 {
+			t.Error("day", day, "expected one file from the last day, got", n)
+		}
+	}
+
+	cancel()
+	wg.Wait()
+
+	// - months later the entries at the front of the split children have all moved on, their nodes are
+	// removed instead of being kept around empty
+	var checkCollapsed func(child Bucket, month int)
+	checkCollapsed = func(child Bucket, month int) {
+		children := child.Node().children
+		if len(children) == 1 {
+			t.Error("month", month, "split node with only one child was not collapsed")
+		}
+		for i, grandchild := range children {
+			if i < len(children)-1 && grandchild.Node().NumFiles() == 0 {
+				t.Error("month", month, "empty child", i, "of split node was not removed")
+			}
+			checkCollapsed(grandchild, month)
+		}
+	}
+	for month := 1; month <= 12; month++ {
+		clock = clock.Add(30 * 24 * time.Hour)
+		bucket.Roll(SORT_BY_MODTIME, clock)
+		checkChildren(14 + 30*month)
+		for _, child := range bucket.children {
+			checkCollapsed(child, month)
+		}
+	}
+
+	if bucket.Roll(SORT_BY_MODTIME, clock) != 0 {
+		t.Error("expected nothing to move without time passing")
+	}
+	if NewBucket(SORT_BY_NAME, NewEntryTable()).Roll(SORT_BY_NAME, clock.Add(24*time.Hour)) != 0 {
+		t.Error("expected the thresholds of names to not depend on the time")
+	}
+
+	log.Println("TestRollModTime finished")
+}
+
 func TestLess(t *testing.T) {
-	if NameThreshold("=.html").Less(NameThreshold("9")) {
+	name, modtime, size, ext := &orderings[SORT_BY_NAME], &orderings[SORT_BY_MODTIME], &orderings[SORT_BY_SIZE], &orderings[SORT_BY_EXTENSION]
+
+	if name.lesskey("=.html", "9") {
 		t.Error("=.html < 9")
 	}
 
-	if NameThreshold("=.html").Less(NameThreshold("1")) {
+	if name.lesskey("=.html", "1") {
 		t.Error("=.html < 1")
 	}
 
-	if NameThreshold("b").Less(NameThreshold("aaaaaaaaaaaaaaaaaaaaaaaaa")) {
+	if name.lesskey("b", "aaaaaaaaaaaaaaaaaaaaaaaaa") {
 		t.Error("b < aaaaaaaaaaaaaaaaaaaaaaaaa")
 	}
 
-	if NameThreshold("a").Less(NameThreshold("0")) {
+	if name.lesskey("a", "0") {
 		t.Error("a < 0")
 	}
 
-	if NameThreshold("a").Less(NameThreshold("A")) {
+	if name.lesskey("a", "A") {
 		t.Error("a < A")
 	}
 
-	if ModTimeThreshold(time.Now().Add(-time.Minute)).Less(ModTimeThreshold(time.Now())) {
+	if modtime.lesskey(time.Now().Add(-time.Minute), time.Now()) {
 		t.Error("time.Now().Add(-time.Minute) < time.Now")
 	}
 
-	if SizeThreshold(0).Less(SizeThreshold(1)) {
+	if size.lesskey(int64(0), int64(1)) {
 		t.Error("0 < 1")
 	}
 
+	if !ext.lesskey("", "0") {
+		t.Error("! < 0")
+	}
+
+	if ext.lesskey("iso", "ISO") || !ext.Equal("ISO", "iso") {
+		t.Error("iso != ISO")
+	}
+
 	log.Println("TestLess finished")
 }
 
 func BenchmarkRegexpBuiltin(b *testing.B) {
 	b.StopTimer()
 
-	mem := ResultMemory{
-		NewNameBucket(),
-		NewDirBucket(),
-		NewModTimeBucket(),
-		NewSizeBucket(),
-	}
+	mem := NewResultMemory()
 	config := Configuration{
 		cores:       runtime.NumCPU(),
 		directories: []string{path.Join(os.Getenv("GOPATH"))},
 		maxinotify:  1024,
 	}
-	newdirs := make(chan string)
-	crawlerquery := make(chan *regexp.Regexp)
-	var wg sync.WaitGroup
-
-	finish := make(chan struct{})
-	wg.Add(1)
-	go Crawler(&wg, mem, config, newdirs, crawlerquery, finish)
-	time.Sleep(10 * time.Millisecond)
-	wg.Wait()
-	close(finish)
+	startCrawler(testCrawler{mem: mem, config: config}).stop()
 
 	searchterm1 := ".*\\.cc$"
 	query1, _ := regexp.Compile(searchterm1)
@@ -222,19 +455,19 @@ func BenchmarkRegexpBuiltin(b *testing.B) {
 
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
-		WalkEntries(mem.bymodtime.(*Node), gtk.SORT_ASCENDING, func(entry *FileEntry) bool {
+		WalkEntries(mem.columns[SORT_BY_MODTIME].(*Node), gtk.SORT_ASCENDING, func(entry *FileEntry) bool {
 			if entry == nil {
 				return true
 			}
 
 			query1.MatchString(entry.name)
-			query1.MatchString(entry.dir)
+			query1.MatchString(entry.Dir())
 
 			query2.MatchString(entry.name)
-			query2.MatchString(entry.dir)
+			query2.MatchString(entry.Dir())
 
 			query3.MatchString(entry.name)
-			query3.MatchString(entry.dir)
+			query3.MatchString(entry.Dir())
 			return true
 		})
 	}
@@ -245,28 +478,14 @@ func BenchmarkRegexpPCRE(b *testing.B) {
 
 	b.StopTimer()
 
-	mem := ResultMemory{
-		NewNameBucket(),
-		NewDirBucket(),
-		NewModTimeBucket(),
-		NewSizeBucket(),
-	}
+	mem := NewResultMemory()
 	config := Configuration{
 		cores:       runtime.NumCPU(),
 		directories: []string{path.Join(os.Getenv("GOPATH"))},
 		maxinotify:  1024,
 	}
 
-	newdirs := make(chan string)
-	crawlerquery := make(chan *regexp.Regexp)
-	var wg sync.WaitGroup
-
-	finish := make(chan struct{})
-	wg.Add(1)
-	go Crawler(&wg, mem, config, newdirs, crawlerquery, finish)
-	time.Sleep(10 * time.Millisecond)
-	wg.Wait()
-	close(finish)
+	startCrawler(testCrawler{mem: mem, config: config}).stop()
 
 	searchterm1 := ".*\\.cc$"
 	searchterm2 := ".*\\.cc"
@@ -289,24 +508,24 @@ func BenchmarkRegexpPCRE(b *testing.B) {
 
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
-		WalkEntries(mem.bymodtime.(*Node), gtk.SORT_ASCENDING, func(entry *FileEntry) bool {
+		WalkEntries(mem.columns[SORT_BY_MODTIME].(*Node), gtk.SORT_ASCENDING, func(entry *FileEntry) bool {
 			if entry == nil {
 				return true
 			}
 
 			namematcher1 := pcrere1.MatcherString(entry.name, 0)
 			namematcher1.Matches()
-			dirmatcher1 := pcrere1.MatcherString(entry.dir, 0)
+			dirmatcher1 := pcrere1.MatcherString(entry.Dir(), 0)
 			dirmatcher1.Matches()
 
 			namematcher2 := pcrere2.MatcherString(entry.name, 0)
 			namematcher2.Matches()
-			dirmatcher2 := pcrere2.MatcherString(entry.dir, 0)
+			dirmatcher2 := pcrere2.MatcherString(entry.Dir(), 0)
 			dirmatcher2.Matches()
 
 			namematcher3 := pcrere3.MatcherString(entry.name, 0)
 			namematcher3.Matches()
-			dirmatcher3 := pcrere3.MatcherString(entry.dir, 0)
+			dirmatcher3 := pcrere3.MatcherString(entry.Dir(), 0)
 			dirmatcher3.Matches()
 
 			return true
@@ -318,40 +537,15 @@ func BenchmarkRegexpPCRE(b *testing.B) {
 }
 
 func BenchmarkTake(b *testing.B) {
-	memslice := ResultMemory{
-		new(FileEntries),
-		new(FileEntries),
-		new(FileEntries),
-		new(FileEntries),
-	}
-	membuckets := ResultMemory{
-		NewNameBucket(),
-		NewDirBucket(),
-		NewModTimeBucket(),
-		NewSizeBucket(),
-	}
+	memslice := NewSliceMemory()
+	membuckets := NewResultMemory()
 	config := Configuration{
 		cores:       runtime.NumCPU(),
 		directories: []string{path.Join(os.Getenv("HOME")), "/tmp", "/etc", "/usr"},
 		maxinotify:  1024,
 	}
-	newdirs := make(chan string)
-	crawlerquery := make(chan *regexp.Regexp)
-	var wg1, wg2 sync.WaitGroup
-
-	finish := make(chan struct{})
-	wg1.Add(1)
-	go Crawler(&wg1, memslice, config, newdirs, crawlerquery, finish)
-	time.Sleep(100 * time.Millisecond)
-	wg1.Wait()
-	close(finish)
-
-	finish = make(chan struct{})
-	wg2.Add(1)
-	go Crawler(&wg2, membuckets, config, newdirs, crawlerquery, finish)
-	time.Sleep(100 * time.Millisecond)
-	wg2.Wait()
-	close(finish)
+	startCrawler(testCrawler{mem: memslice, config: config}).stop()
+	startCrawler(testCrawler{mem: membuckets, config: config}).stop()
 
 	searchterm := ".*\\.go$"
 	query, _ := regexp.Compile(searchterm)
@@ -377,16 +571,16 @@ func BenchmarkTake(b *testing.B) {
 		query     *regexp.Regexp
 		n         int
 	}{
-		{"SliceName", memslice.byname, SORT_BY_NAME, gtk.SORT_ASCENDING, query, 100},
-		{"SliceModTime", memslice.bymodtime, SORT_BY_MODTIME, gtk.SORT_ASCENDING, query, 100},
-		{"SliceSize", memslice.bysize, SORT_BY_SIZE, gtk.SORT_ASCENDING, query, 100},
-		{"BucketName", membuckets.byname, SORT_BY_NAME, gtk.SORT_ASCENDING, query, 100},
-		{"BucketModTime", membuckets.bymodtime, SORT_BY_MODTIME, gtk.SORT_ASCENDING, query, 100},
-		{"BucketSize", membuckets.bysize, SORT_BY_SIZE, gtk.SORT_ASCENDING, query, 100},
+		{"SliceName", memslice.columns[SORT_BY_NAME], SORT_BY_NAME, gtk.SORT_ASCENDING, query, 100},
+		{"SliceModTime", memslice.columns[SORT_BY_MODTIME], SORT_BY_MODTIME, gtk.SORT_ASCENDING, query, 100},
+		{"SliceSize", memslice.columns[SORT_BY_SIZE], SORT_BY_SIZE, gtk.SORT_ASCENDING, query, 100},
+		{"BucketName", membuckets.columns[SORT_BY_NAME], SORT_BY_NAME, gtk.SORT_ASCENDING, query, 100},
+		{"BucketModTime", membuckets.columns[SORT_BY_MODTIME], SORT_BY_MODTIME, gtk.SORT_ASCENDING, query, 100},
+		{"BucketSize", membuckets.columns[SORT_BY_SIZE], SORT_BY_SIZE, gtk.SORT_ASCENDING, query, 100},
 	}
 
 	for _, bm := range benchmarks {
-		cache := MatchCaches{NewSimpleCache(), NewSimpleCache()}
+		cache := MatchCaches{NewSimpleCache(), NewSimpleCache(), FILTER_ALL}
 		b.Run(bm.name, func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
 				go taker(&entries)
@@ -2,38 +2,117 @@ package main
 
 import (
 	//"fmt"
-	"io/ioutil"
+	"context"
+	"errors"
 	"log"
 	"os"
 	"path"
 	"regexp"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	fsnotify "github.com/fsnotify/fsnotify"
 	gtk "github.com/gotk3/gotk3/gtk"
+	unix "golang.org/x/sys/unix"
 )
 
+// - direntry is the directory the entry is listed in, or for the row of a directory itself, which has
+// isself set, that directory, so that all entries of a directory share its path instead of storing their
+// own copy, and a directory that is moved only has to change its own path
+// - id is the index of the entry in the table of the mem it is in, zero while it is in none
 type FileEntry struct {
-	dir     string
-	name    string
-	modtime time.Time
-	size    int64
+	direntry *DirEntry
+	name     string
+	modtime  time.Time
+	size     int64
+	mode     os.FileMode
+	uid      uint32
+	gid      uint32
+	id       atomic.Uint32
+	inode    uint64
+	device   uint64
+	nlink    uint64
+	linked   bool
+	isself   bool
+
+	recursivesize int64
+	aliases       atomic.Pointer[AliasGroup]
 }
 
-type FilesChannel struct {
-	byname    chan SortedByName
-	bydir     chan SortedByDir
-	bymodtime chan SortedByModTime
-	bysize    chan SortedBySize
+func (entry *FileEntry) Dir() string {
+	if entry.isself {
+		return path.Dir(entry.direntry.path)
+	}
+	return entry.direntry.path
+}
+
+// - one channel for the collector of every column
+type FilesChannel []chan []*FileEntry
+
+func NewFilesChannel() FilesChannel {
+	collect := make(FilesChannel, len(orderings))
+	for i := range collect {
+		collect[i] = make(chan []*FileEntry)
+	}
+	return collect
+}
+
+// - sends files to all collectors, the collectors call wg.Done() once they merged them, when ctx is
+// cancelled before a collector received the files we call wg.Done() for it instead
+func (collect FilesChannel) send(ctx context.Context, wg *sync.WaitGroup, files []*FileEntry) {
+	wg.Add(len(collect))
+	for _, column := range collect {
+		select {
+		case column <- files:
+		case <-ctx.Done():
+			wg.Done()
+		}
+	}
 }
 
+// - whoever sends a directory to newdirs calls wg.Add(1) before sending, the same as above, when ctx is
+// cancelled before the directory is received we call wg.Done() for it ourselves
+func sendDir(ctx context.Context, wg *sync.WaitGroup, newdirs chan string, dir string) bool {
+	wg.Add(1)
+	select {
+	case newdirs <- dir:
+		return true
+	case <-ctx.Done():
+		wg.Done()
+		return false
+	}
+}
+
+// - the results sorted by every column, indexed by SortColumn, and the table of the entries whose ids
+// the columns store, the entries stay alive as long as the mem does and not longer
 type ResultMemory struct {
-	byname    CrawlResult
-	bydir     CrawlResult
-	bymodtime CrawlResult
-	bysize    CrawlResult
+	columns []CrawlResult
+	table   *EntryTable
+}
+
+func NewResultMemory() ResultMemory {
+	mem := ResultMemory{make([]CrawlResult, len(orderings)), NewEntryTable()}
+	for i := range mem.columns {
+		mem.columns[i] = NewBucket(SortColumn(i), mem.table)
+	}
+	return mem
+}
+
+// - a mem that keeps every column in a sorted slice instead of a bucket
+func NewSliceMemory() ResultMemory {
+	mem := ResultMemory{make([]CrawlResult, len(orderings)), NewEntryTable()}
+	for i := range mem.columns {
+		mem.columns[i] = NewFileEntries(mem.table)
+	}
+	return mem
+}
+
+func (mem ResultMemory) Column(sortcolumn SortColumn) CrawlResult {
+	return mem.columns[sortcolumn]
 }
 
 type Cache interface {
@@ -74,15 +153,16 @@ func (c *SimpleCache) Put(k string, v bool) {
 }
 
 type MatchCaches struct {
-	dirs  Cache
-	names Cache
+	dirs   Cache
+	names  Cache
+	filter EntryFilter
 }
 
 func testMatchCaches(dircache Cache, namecache Cache, entry *FileEntry, query *regexp.Regexp) (bool, bool) {
 	matchedname, knownname, matcheddir, knowndir := true, true, false, false
 	if query != nil {
 		matchedname, knownname = namecache.Test(entry.name)
-		matcheddir, knowndir = dircache.Test(entry.dir)
+		matcheddir, knowndir = dircache.Test(entry.Dir())
 
 		if !matchedname && !matcheddir {
 			if !knownname {
@@ -90,8 +170,8 @@ func testMatchCaches(dircache Cache, namecache Cache, entry *FileEntry, query *r
 				namecache.Put(entry.name, matchedname)
 			}
 			if !knowndir && !matchedname {
-				matcheddir = query.MatchString(entry.dir)
-				dircache.Put(entry.dir, matcheddir)
+				matcheddir = query.MatchString(entry.Dir())
+				dircache.Put(entry.Dir(), matcheddir)
 			}
 		}
 	}
@@ -103,30 +183,27 @@ type CrawlResult interface {
 	Merge(sortcolumn SortColumn, files []*FileEntry)
 	Take(cache MatchCaches, sortcolumn SortColumn, direction gtk.SortType, query *regexp.Regexp, n int, abort chan struct{}, results chan *FileEntry)
 	Remove(sortcolumn SortColumn, files []*FileEntry)
+	Roll(sortcolumn SortColumn, now time.Time) int
 	NumFiles() int
 }
 
 type FileEntries struct {
-	queue  []*FileEntry
-	sorted []*FileEntry
+	table  *EntryTable
+	queue  []EntryId
+	sorted []EntryId
+}
+
+func NewFileEntries(table *EntryTable) *FileEntries {
+	return &FileEntries{table: table}
 }
 
 func (entries *FileEntries) Merge(_ SortColumn, files []*FileEntry) {
-	entries.queue = append(entries.queue, files...)
+	entries.queue = append(entries.queue, entries.table.Ref(files)...)
 }
 
 func (entries *FileEntries) Commit(sortcolumn SortColumn) {
-	switch sortcolumn {
-	case SORT_BY_NAME:
-		sort.Stable(SortedByName(entries.queue))
-	case SORT_BY_MODTIME:
-		sort.Stable(SortedByModTime(entries.queue))
-	case SORT_BY_SIZE:
-		sort.Stable(SortedBySize(entries.queue))
-	case SORT_BY_DIR:
-		sort.Stable(SortedByDir(entries.queue))
-	}
-	entries.sorted = sortMerge(sortcolumn, entries.sorted, entries.queue)
+	sortEntryIds(entries.table, sortcolumn, entries.queue)
+	entries.sorted = sortMergeIds(entries.table, sortcolumn, entries.sorted, entries.queue)
 	entries.queue = nil
 }
 
@@ -172,10 +249,10 @@ sortedloop:
 		default:
 
 			index := indexfunc(l, i)
-			entry := entries.sorted[index]
+			entry := entries.table.Get(entries.sorted[index])
 			matchedname, matcheddir := testMatchCaches(dircache, namecache, entry, query)
 
-			if query == nil || matchedname || matcheddir {
+			if cache.filter.Accept(entry) && (query == nil || matchedname || matcheddir) {
 				results <- entry
 				numresults += 1
 			}
@@ -192,165 +269,535 @@ sortedloop:
 	}
 }
 
-func (entries *FileEntries) Remove(dirs []string, files []*FileEntry) {
-	entries.Commit(SORT_BY_DIR)
+func (entries *FileEntries) Remove(sortcolumn SortColumn, files []*FileEntry) {
+	entries.Commit(sortcolumn)
+
+	removed := make(map[int]bool)
+	for _, file := range files {
+		index := searchFileEntry(entries.table, sortcolumn, entries.sorted, file, removed)
+		if index >= 0 {
+			removed[index] = true
+		}
+	}
+
+	if len(removed) > 0 {
+		released := make([]EntryId, 0, len(removed))
+		newsorted := entries.sorted[:0]
+		for i, id := range entries.sorted {
+			if removed[i] {
+				released = append(released, id)
+			} else {
+				newsorted = append(newsorted, id)
+			}
+		}
+		entries.sorted = newsorted
+		entries.table.Unref(released)
+	}
+}
+
+// - a slice has no thresholds that could be moved
+func (entries *FileEntries) Roll(_ SortColumn, _ time.Time) int {
+	return 0
 }
 
 func (entries *FileEntries) NumFiles() int {
 	return len(entries.queue) + len(entries.sorted)
 }
 
-func visit(wg *sync.WaitGroup, config Configuration, watcher *fsnotify.Watcher, maxwatch chan struct{}, maxproc chan struct{}, newdirs chan string, collect FilesChannel, direntry *DirEntry, dir string) {
-	relevantage := time.Now().Add(-time.Hour * 24 * 31)
+// - returned by listDir for a directory that is crawled below a followed link already, the directory is
+// kept in direntries without any files, so that it is not send to newdirs again every time its parent is
+// read, it is only read again when it is rescanned
+var errLinked = errors.New("directory is crawled below a link")
+
+// - lists dir with getdents, the type of every entry comes from d_type, so unlike ioutil.ReadDir we don't
+// lstat every entry just to find the subdirectories, files are only returned by name and stat'ed later
+// with statFiles
+func listDir(exclusions *Exclusions, links *Links, dir string) (os.FileInfo, []string, []string, error) {
+	// - when we follow links, dir may be a link itself, and we want to know about the directory it points to
+	lstat := os.Lstat
+	if links != nil {
+		lstat = os.Stat
+	}
+	dirinfo, err := lstat(dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !links.Visit(dir, statInodeKey(dirinfo)) {
+		return nil, nil, nil, errLinked
+	}
 
-	maxwatch <- struct{}{}
-	watcherr := watcher.Add(dir)
+	dirfile, err := os.Open(dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer dirfile.Close()
 
-	if watcherr != nil {
-		<-maxwatch
-	} else {
+	// - os.ReadDir would sort the entries by name, which we don't need
+	entries, err := dirfile.ReadDir(-1)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-		dirinfo, staterr := os.Lstat(dir)
+	hasgitignore := false
+	for _, entry := range entries {
+		if entry.Name() == ".gitignore" && !entry.IsDir() {
+			hasgitignore = true
+		}
+	}
+	exclusions.Load(dir, hasgitignore)
+	rules := exclusions.Rules(dir)
+
+	names := make([]string, 0, len(entries))
+	var subdirs []string
+	for _, entry := range entries {
+		entrypath := path.Join(dir, entry.Name())
+
+		// - a link that we follow is listed as a directory instead of a file
+		if entry.Type()&os.ModeSymlink != 0 && !excluded(rules, entrypath, true) && links.Follow(entrypath) {
+			subdirs = append(subdirs, entrypath)
+			continue
+		}
 
-		var infos []os.FileInfo
-		var readerr error
-		if staterr == nil {
-			infos, readerr = ioutil.ReadDir(dir)
+		if excluded(rules, entrypath, entry.IsDir()) {
+			continue
 		}
-		<-maxproc
 
-		if staterr != nil || readerr != nil {
-			watcher.Remove(dir)
-			<-maxwatch
+		if entry.IsDir() {
+			subdirs = append(subdirs, entrypath)
 		} else {
-			modtime := dirinfo.ModTime()
+			names = append(names, entry.Name())
+		}
+	}
+
+	return dirinfo, names, subdirs, nil
+}
+
+// - stats all files in dir relative to one open file descriptor of dir, so that the kernel does not
+// have to resolve the whole path for every file, files that vanished since dir was listed are skipped,
+// other errors are recorded and the file is skipped as well
+func statFiles(stats *CrawlStats, direntry *DirEntry, names []string) ([]*FileEntry, error) {
+	dir := direntry.path
+	// - an O_PATH descriptor is enough for fstatat, and cheaper to get than a readable one
+	dirfd, err := unix.Open(dir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: err}
+	}
+	defer unix.Close(dirfd)
+
+	fileentries := make([]*FileEntry, 0, len(names))
+	for _, name := range names {
+		var stat unix.Stat_t
+		err := unix.Fstatat(dirfd, name, &stat, unix.AT_SYMLINK_NOFOLLOW)
+		for err == unix.EINTR {
+			err = unix.Fstatat(dirfd, name, &stat, unix.AT_SYMLINK_NOFOLLOW)
+		}
 
-			addedinotify := true
-			if len(maxwatch)+1 >= config.maxinotify || modtime.Before(relevantage) || len(infos) < 1 {
-				addedinotify = false
-				watcher.Remove(dir)
-				<-maxwatch
+		if err != nil {
+			if err != unix.ENOENT {
+				stats.Error(path.Join(dir, name), "fstatat", err)
 			}
+			continue
+		}
 
-			wg.Add(4)
+		fileentries = append(fileentries, newFileEntry(direntry, name, &stat))
+	}
 
-			fileentries := make([]*FileEntry, len(infos))
-			numfiles := 0
+	return fileentries, nil
+}
 
-			for _, fileinfo := range infos {
-				entrypath := path.Join(dir, fileinfo.Name())
-				if fileinfo.IsDir() {
-					newdirs <- entrypath
-				} else {
-					entry := &FileEntry{
-						dir:     dir,
-						name:    fileinfo.Name(),
-						modtime: fileinfo.ModTime(),
-						size:    fileinfo.Size(),
-					}
-					fileentries[numfiles] = entry
-					numfiles += 1
-				}
-			}
+// - the files that are read point to direntry, which is not changed otherwise
+func readDir(exclusions *Exclusions, links *Links, stats *CrawlStats, direntry *DirEntry) (os.FileInfo, []*FileEntry, []string, error) {
+	dirinfo, names, subdirs, err := listDir(exclusions, links, direntry.path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-			direntry.path = dir
-			direntry.modtime = modtime
-			direntry.files = fileentries[:numfiles]
-			direntry.inotify = addedinotify
+	fileentries, err := statFiles(stats, direntry, names)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-			if numfiles > 0 {
-				collect.byname <- fileentries[:numfiles]
-				collect.bydir <- fileentries[:numfiles]
-				collect.bymodtime <- fileentries[:numfiles]
-				collect.bysize <- fileentries[:numfiles]
-			} else {
-				defer func() {
-					wg.Done()
-					wg.Done()
-					wg.Done()
-					wg.Done()
-				}()
-			}
+	return dirinfo, fileentries, subdirs, nil
+}
+
+// - directories that have not changed for a while, and empty directories, are polled instead of watched
+// with inotify, when they change later on they are promoted to inotify by Watches.Promote
+func keepWatching(modtime time.Time, numentries int) bool {
+	relevantage := time.Now().Add(-time.Hour * 24 * 31)
+	return !modtime.Before(relevantage) && numentries > 0
+}
+
+func visit(ctx context.Context, wg *sync.WaitGroup, config Configuration, exclusions *Exclusions, links *Links, watches *Watches, poller *Poller, stats *CrawlStats, journal *Journal, maxproc chan struct{}, newdirs chan string, collect FilesChannel, direntry *DirEntry, dir string) {
+	defer wg.Done()
+	defer stats.Visited()
+
+	// - we start watching before reading the directory so that we don't miss changes while reading it,
+	// afterwards we decide if we keep watching it or if it is polled instead
+	watches.Add(direntry)
+
+	dirinfo, names, subdirs, readerr := listDir(exclusions, links, dir)
+	<-maxproc
+
+	// - everything inside a directory that was created after the initial crawl was created along with it,
+	// the subdirectories are recorded before they are send to newdirs, so that they are known as created
+	// when they are visited
+	created := journal.Visited(dir, subdirs)
+
+	if readerr != nil {
+		if !os.IsNotExist(readerr) && readerr != errLinked {
+			stats.Error(dir, "readdir", readerr)
 		}
+		watches.Remove(direntry)
+		return
 	}
 
-	defer wg.Done()
+	// - subdirectories are send to newdirs before we stat our files, so that other goroutines can start
+	// listing them right away, we must not hold on to maxproc while sending, because the goroutine that
+	// receives newdirs waits for maxproc before it starts a visit
+	for _, subdir := range subdirs {
+		if !sendDir(ctx, wg, newdirs, subdir) {
+			return
+		}
+	}
+
+	select {
+	case maxproc <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	fileentries, staterr := statFiles(stats, direntry, names)
+	<-maxproc
+
+	if staterr != nil {
+		if !os.IsNotExist(staterr) {
+			stats.Error(dir, "readdir", staterr)
+		}
+		watches.Remove(direntry)
+		return
+	}
+
+	stats.Clear(dir)
+	modtime := dirinfo.ModTime()
+
+	if !keepWatching(modtime, len(fileentries)+len(subdirs)) {
+		watches.Remove(direntry)
+	}
+
+	direntry.modtime = modtime
+	direntry.files = fileentries
+	direntry.self = newDirFileEntry(direntry, dirinfo)
+	direntry.device = direntry.self.device
+	markLinked(direntry.linked, direntry.self, fileentries)
+	poller.Add(direntry, time.Now())
+	stats.Indexed(fileentries)
+	if created {
+		journal.Diff(nil, fileentries)
+	}
+
+	// - the directory itself is indexed as a row too, but it is not counted as an indexed file
+	rows := make([]*FileEntry, 0, len(fileentries)+1)
+	rows = append(rows, fileentries...)
+	rows = append(rows, direntry.self)
+
+	collect.send(ctx, wg, rows)
 }
 
-func collectByName(wg *sync.WaitGroup, mem ResultMemory, collect FilesChannel, finish chan struct{}) {
-	for {
-		select {
-		case files := <-collect.byname:
-			newbyname := make([]*FileEntry, len(files))
-			copy(newbyname, files)
+func markLinked(linked bool, self *FileEntry, fileentries []*FileEntry) {
+	if self != nil {
+		self.linked = linked
+	}
+	for _, entry := range fileentries {
+		entry.linked = linked
+	}
+}
 
-			sort.Stable(SortedByName(newbyname))
-			mem.byname.Merge(SORT_BY_NAME, newbyname)
+// - entries in the buckets are found by their sort key, so entries that are removed must be the same
+// entries that were merged before, with the same modtime and size, entries that changed on disk are
+// therefore removed and then merged again as new entries
+// - the columns only store the ids of entries, an id is given back to the table of mem by the last
+// column that removes it
+func mergeFiles(mem ResultMemory, files []*FileEntry) {
+	if len(files) == 0 {
+		return
+	}
 
-			wg.Done()
-		case <-finish:
+	for i := range mem.columns {
+		sortcolumn := SortColumn(i)
+		sorted := make([]*FileEntry, len(files))
+		copy(sorted, files)
+		sortFileEntries(sortcolumn, sorted)
+		mem.Column(sortcolumn).Merge(sortcolumn, sorted)
+	}
+}
+
+func removeFiles(mem ResultMemory, files []*FileEntry) {
+	if len(files) == 0 {
+		return
+	}
+
+	for i := range mem.columns {
+		sortcolumn := SortColumn(i)
+		sorted := make([]*FileEntry, len(files))
+		copy(sorted, files)
+		sortFileEntries(sortcolumn, sorted)
+		mem.Column(sortcolumn).Remove(sortcolumn, sorted)
+	}
+}
+
+// - compares the entries we have stored for a directory with freshly read entries, entries that
+// have vanished or changed are returned as removed, new or changed entries as added, unchanged
+// entries are kept so that the stored pointers stay the same as the ones in the buckets
+func diffFileEntries(old []*FileEntry, current []*FileEntry) (removed, added, kept []*FileEntry) {
+	byname := make(map[string]*FileEntry, len(old))
+	for _, entry := range old {
+		byname[entry.name] = entry
+	}
+
+	for _, entry := range current {
+		oldentry, ok := byname[entry.name]
+		if !ok {
+			added = append(added, entry)
+			continue
+		}
+
+		delete(byname, entry.name)
+		// - changing the mode or owner of a file does not change its modtime, and a file that was replaced
+		// by another one has a different inode
+		if oldentry.size != entry.size || !oldentry.modtime.Equal(entry.modtime) ||
+			oldentry.mode != entry.mode || oldentry.uid != entry.uid || oldentry.gid != entry.gid || oldentry.inode != entry.inode {
+			removed = append(removed, oldentry)
+			added = append(added, entry)
+		} else {
+			kept = append(kept, oldentry)
+		}
+	}
+
+	for _, entry := range old {
+		if _, ok := byname[entry.name]; ok {
+			removed = append(removed, entry)
+		}
+	}
+
+	return removed, added, kept
+}
+
+// - re-read a directory we already know, remove vanished and changed entries from the buckets and merge
+// new ones, new subdirectories are send to newdirs to be visited, subdirectories that we know but that
+// are gone are removed together with everything below them
+func updateDirectory(ctx context.Context, wg *sync.WaitGroup, mem ResultMemory, exclusions *Exclusions, links *Links, direntries *sync.Map, watches *Watches, stats *CrawlStats, journal *Journal, newdirs chan string, moves *Moves, direntry *DirEntry) {
+	dirinfo, fileentries, subdirs, readerr := readDir(exclusions, links, stats, direntry)
+	if readerr == errLinked {
+		return
+	}
+	if readerr != nil {
+		// - a directory that is gone may have been moved somewhere else, with moves we find out later
+		if os.IsNotExist(readerr) && moves.Vanished(direntry.path) {
 			return
 		}
+		removeDirectory(mem, direntries, watches, stats, journal, direntry.path)
+		if !os.IsNotExist(readerr) {
+			stats.Error(direntry.path, "readdir", readerr)
+		}
+		return
+	}
+
+	stats.Clear(direntry.path)
+	markLinked(direntry.linked, nil, fileentries)
+	removed, added, kept := diffFileEntries(direntry.files, fileentries)
+	if !moves.Files(removed, added) {
+		removeFiles(mem, removed)
+		mergeFiles(mem, added)
+		journal.Diff(removed, added)
+	}
+	stats.Unindexed(removed)
+	stats.Indexed(added)
+
+	lastmodtime := direntry.modtime
+	direntry.modtime = dirinfo.ModTime()
+	direntry.files = append(kept, added...)
+
+	// - the row of the directory itself is replaced when its modtime or metadata changed, directories
+	// loaded from an old index don't have one yet
+	var oldself []*FileEntry
+	if direntry.self != nil {
+		oldself = []*FileEntry{direntry.self}
+	}
+	self := newDirFileEntry(direntry, dirinfo)
+	markLinked(direntry.linked, self, nil)
+	removedself, addedself, _ := diffFileEntries(oldself, []*FileEntry{self})
+	if len(addedself) > 0 {
+		removeFiles(mem, removedself)
+		mergeFiles(mem, addedself)
+		direntry.self = self
+	}
+	direntry.device = self.device
+
+	current := make(map[string]bool, len(subdirs))
+	for _, subdir := range subdirs {
+		current[subdir] = true
+		if _, known := direntries.Load(subdir); known {
+			continue
+		}
+
+		// - a subdirectory we don't know was either created since we last read this directory, or it
+		// is one we skip, like a mount point, those are send again and dropped again every time
+		if !createdSince(subdir, lastmodtime) {
+			sendDir(ctx, wg, newdirs, subdir)
+		} else if !moves.Arrived(subdir) {
+			journal.Created(subdir)
+			sendDir(ctx, wg, newdirs, subdir)
+		}
+	}
+
+	var vanished []string
+	direntries.Range(func(key, value interface{}) bool {
+		dir := key.(string)
+		if path.Dir(dir) == direntry.path && !current[dir] {
+			vanished = append(vanished, dir)
+		}
+		return true
+	})
+
+	for _, dir := range vanished {
+		if !moves.Vanished(dir) {
+			removeDirectory(mem, direntries, watches, stats, journal, dir)
+		}
 	}
 }
 
-func collectByDir(wg *sync.WaitGroup, mem ResultMemory, collect FilesChannel, finish chan struct{}) {
-	for {
-		select {
-		case files := <-collect.bydir:
-			newbydir := make([]*FileEntry, len(files))
-			copy(newbydir, files)
+// - the ctime of a directory changes when it is created and when it is renamed, but not when something
+// is mounted on it, timestamps are coarse so a directory created right after its parent changed can
+// have the same ctime as the modtime of the parent
+func createdSince(dir string, since time.Time) bool {
+	dirinfo, err := os.Lstat(dir)
+	if err != nil {
+		return false
+	}
+	stat := dirinfo.Sys().(*syscall.Stat_t)
+	return !time.Unix(stat.Ctim.Sec, stat.Ctim.Nsec).Before(since)
+}
 
-			// - should already be sorted by dir
-			//sort.Stable(SortedByDir(newbydir))
-			mem.bydir.Merge(SORT_BY_DIR, newbydir)
+// - forces dir and all directories below it that we know to be read again, even if their modtime did not
+// change, so that changes we missed, because the inotify queue overflowed or the machine was suspended,
+// are applied to mem, parents are updated before their children so that vanished subdirectories are
+// removed before we try to read them
+func rescanDirectory(ctx context.Context, wg *sync.WaitGroup, mem ResultMemory, exclusions *Exclusions, links *Links, direntries *sync.Map, watches *Watches, stats *CrawlStats, journal *Journal, newdirs chan string, dir string) int {
+	var dirs []string
+	direntries.Range(func(key, value interface{}) bool {
+		subdir := key.(string)
+		if subdir == dir || strings.HasPrefix(subdir, dir+"/") {
+			dirs = append(dirs, subdir)
+		}
+		return true
+	})
+	sort.Strings(dirs)
 
-			wg.Done()
-		case <-finish:
-			return
+	updated := 0
+	for _, subdir := range dirs {
+		if value, ok := direntries.Load(subdir); ok {
+			updateDirectory(ctx, wg, mem, exclusions, links, direntries, watches, stats, journal, newdirs, nil, value.(*DirEntry))
+			updated += 1
 		}
 	}
+
+	return updated
 }
 
-func collectByModTime(wg *sync.WaitGroup, mem ResultMemory, collect FilesChannel, finish chan struct{}) {
-	for {
-		select {
-		case files := <-collect.bymodtime:
-			newbymodtime := make([]*FileEntry, len(files))
-			copy(newbymodtime, files)
+// - a directory loaded from the index is watched again if it is relevant, and only read again if its
+// modtime changed since the index was saved, or if one of its files changed
+// - changing a file in place does not change the modtime of its directory, files in directories that are
+// polled are found by the poller, but the poller skips watched directories, so their files are stat'ed here
+// once, inotify only tells us about changes made after the watch was added
+func reconcileDirectory(ctx context.Context, wg *sync.WaitGroup, mem ResultMemory, exclusions *Exclusions, links *Links, direntries *sync.Map, watches *Watches, stats *CrawlStats, journal *Journal, newdirs chan string, direntry *DirEntry, numentries int) {
+	if _, known := direntries.Load(direntry.path); !known {
+		return
+	}
 
-			sort.Stable(SortedByModTime(newbymodtime))
-			mem.bymodtime.Merge(SORT_BY_MODTIME, newbymodtime)
+	dirinfo, staterr := statDir(direntry)
+	watched := staterr == nil && keepWatching(dirinfo.ModTime(), numentries) && watches.Add(direntry)
 
-			wg.Done()
-		case <-finish:
-			return
+	if staterr != nil {
+		removeDirectory(mem, direntries, watches, stats, journal, direntry.path)
+	} else if !dirinfo.ModTime().Equal(direntry.modtime) || (watched && filesChanged(direntry)) {
+		updateDirectory(ctx, wg, mem, exclusions, links, direntries, watches, stats, journal, newdirs, nil, direntry)
+	}
+}
+
+// - true when one of the files of direntry is gone or was modified after it was indexed, stops at the first one
+func filesChanged(direntry *DirEntry) bool {
+	for _, fileentry := range direntry.files {
+		fileinfo, err := os.Lstat(path.Join(fileentry.Dir(), fileentry.name))
+		if err != nil || fileinfo.ModTime().After(fileentry.modtime) {
+			return true
 		}
 	}
+	return false
+}
+
+// - a directory that was reached through a link is stat'ed through the link, with a plain lstat we would
+// only see the link itself
+func statDir(direntry *DirEntry) (os.FileInfo, error) {
+	if direntry.linked {
+		return os.Stat(direntry.path)
+	}
+	return os.Lstat(direntry.path)
+}
+
+// - remove a directory and all directories below it from direntries, remove their entries from the
+// buckets and stop watching them
+func removeDirectory(mem ResultMemory, direntries *sync.Map, watches *Watches, stats *CrawlStats, journal *Journal, dir string) {
+	var files []*FileEntry
+	var dirs []*FileEntry
+	removed := 0
+	direntries.Range(func(key, value interface{}) bool {
+		subdir := key.(string)
+		if subdir == dir || strings.HasPrefix(subdir, dir+"/") {
+			direntry := value.(*DirEntry)
+			files = append(files, direntry.files...)
+			if direntry.self != nil {
+				dirs = append(dirs, direntry.self)
+			}
+			watches.Remove(direntry)
+			direntries.Delete(subdir)
+			stats.Clear(subdir)
+			removed += 1
+		}
+		return true
+	})
+
+	removeFiles(mem, append(files, dirs...))
+	stats.Unindexed(files)
+	stats.Directories(-removed)
+	journal.Diff(append(files, dirs...), nil)
 }
 
-func collectBySize(wg *sync.WaitGroup, mem ResultMemory, collect FilesChannel, finish chan struct{}) {
+// - merges the files that are sent to files into the column sortcolumn of mem
+func collectColumn(ctx context.Context, wg *sync.WaitGroup, mem ResultMemory, sortcolumn SortColumn, files chan []*FileEntry) {
 	for {
 		select {
-		case files := <-collect.bysize:
-			newbysize := make([]*FileEntry, len(files))
-			copy(newbysize, files)
+		case newfiles := <-files:
+			sorted := make([]*FileEntry, len(newfiles))
+			copy(sorted, newfiles)
 
-			sort.Stable(SortedBySize(newbysize))
-			mem.bysize.Merge(SORT_BY_SIZE, newbysize)
+			sortFileEntries(sortcolumn, sorted)
+			mem.Column(sortcolumn).Merge(sortcolumn, sorted)
 
 			wg.Done()
-		case <-finish:
+		case <-ctx.Done():
 			return
 		}
 	}
 }
 
 type DirEntry struct {
-	path    string
-	modtime time.Time
-	files   []*FileEntry
-	inotify bool
+	path      string
+	modtime   time.Time
+	files     []*FileEntry
+	self      *FileEntry
+	device    uint64
+	inotify   bool
+	forcepoll bool
+	linked    bool
 }
 
 type Events struct {
@@ -360,19 +807,32 @@ type Events struct {
 	ops        []fsnotify.Op
 }
 
+// - the events of a name are read by the crawler while the watcher and the poller queue more of them, so
+// they are never changed in place, a new *Events replaces the old one instead
 func queueEvent(eventqueue *sync.Map, name string, info os.FileInfo, op fsnotify.Op) {
 	timestamp := time.Now()
 
-	events, loaded := eventqueue.LoadOrStore(name, &Events{
-		name:       name,
-		info:       info,
-		timestamps: []time.Time{timestamp},
-		ops:        []fsnotify.Op{op},
-	})
+	for {
+		events, loaded := eventqueue.LoadOrStore(name, &Events{
+			name:       name,
+			info:       info,
+			timestamps: []time.Time{timestamp},
+			ops:        []fsnotify.Op{op},
+		})
+		if !loaded {
+			break
+		}
 
-	if loaded {
-		events.(*Events).timestamps = append(events.(*Events).timestamps, timestamp)
-		events.(*Events).ops = append(events.(*Events).ops, op)
+		old := events.(*Events)
+		queued := &Events{
+			name:       old.name,
+			info:       old.info,
+			timestamps: append(old.timestamps[:len(old.timestamps):len(old.timestamps)], timestamp),
+			ops:        append(old.ops[:len(old.ops):len(old.ops)], op),
+		}
+		if eventqueue.CompareAndSwap(name, events, queued) {
+			break
+		}
 	}
 
 	// if info == nil {
@@ -382,8 +842,28 @@ func queueEvent(eventqueue *sync.Map, name string, info os.FileInfo, op fsnotify
 	// }
 }
 
-func Crawler(wg *sync.WaitGroup, mem ResultMemory, config Configuration, newdirs chan string, query chan *regexp.Regexp, finish chan struct{}) {
-	wg.Add(len(config.directories))
+// - the crawler runs until ctx is cancelled, and only returns after every goroutine it started has exited,
+// so that it can be stopped and started again without leaking anything, wg is done once the initial crawl
+// finished or was cancelled
+func Crawler(ctx context.Context, wg *sync.WaitGroup, mem ResultMemory, config Configuration, newdirs chan string, rescan chan string, query chan *regexp.Regexp, progress chan CrawlProgress, crawlerrors *CrawlErrors, journal *Journal) {
+	if crawlerrors == nil {
+		crawlerrors = NewCrawlErrors()
+	}
+	stats := NewCrawlStats(crawlerrors)
+
+	// - every entry is merged into and removed from the name column, so that is where we keep track of
+	// entries that share an inode, the wrapper is only seen by the crawler, so we wrap a copy of mem
+	if config.dedupe {
+		mem = ResultMemory{append([]CrawlResult(nil), mem.columns...), mem.table}
+		mem.columns[SORT_BY_NAME] = NewAliases(mem.columns[SORT_BY_NAME], stats)
+	}
+
+	// - hooks run for the changes that were recorded in the journal, so they need one even if we were not
+	// given one to keep, it is made before any goroutine is started that could record something
+	hooks := NewHooks(config.hooks)
+	if hooks != nil && journal == nil {
+		journal = NewJournal(JOURNAL_CAPACITY, "")
+	}
 
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -391,26 +871,33 @@ func Crawler(wg *sync.WaitGroup, mem ResultMemory, config Configuration, newdirs
 	}
 	defer watcher.Close()
 
+	// - every goroutine is started with spawn, this is deferred after closing the watcher so that we wait
+	// for all goroutines before the watcher is closed
+	var running sync.WaitGroup
+	defer running.Wait()
+	spawn := func(f func()) {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			f()
+		}()
+	}
+
 	eventqueue := new(sync.Map)
-	go func() {
+	spawn(func() {
 		for {
 			select {
-			case <-finish:
+			case <-ctx.Done():
 				return
 			case event := <-watcher.Events:
 				queueEvent(eventqueue, event.Name, nil, event.Op)
 			case err := <-watcher.Errors:
-				log.Println("error:", err)
+				stats.Error("", "inotify", err)
 			}
 		}
-	}()
+	})
 
-	collect := FilesChannel{
-		make(chan SortedByName),
-		make(chan SortedByDir),
-		make(chan SortedByModTime),
-		make(chan SortedBySize),
-	}
+	collect := NewFilesChannel()
 
 	// inotify:
 	// - need to start watching before first visit
@@ -445,128 +932,278 @@ func Crawler(wg *sync.WaitGroup, mem ResultMemory, config Configuration, newdirs
 	// -- else nothing new was created inside directory
 	// --- loop over known files, stat, when changed modtime remove from mem and add as new
 
-	maxwatch := make(chan struct{}, config.maxinotify)
+	// - with config.maxinotify set to zero the number of watches is derived from the kernel limit, which
+	// is read again while polling in case it is changed at runtime
+	maxinotify := config.maxinotify
+	if maxinotify <= 0 {
+		maxinotify = readInotifyLimit()
+	}
+	watches := NewWatches(watcher, maxinotify, crawlerrors)
+	poller := NewPoller(config.pollrate)
 	maxproc := make(chan struct{}, config.cores)
 
-	direntries := make([]*DirEntry, 0, 100000)
+	exclusions := NewExclusions(config.exclude, config.gitignore)
+
+	// - without mountinfo we can't tell where filesystems begin, so everything is crawled and watched
+	mounts, mountserr := ReadMountInfo()
+	if mountserr != nil {
+		log.Println("could not read mounts:", mountserr)
+	}
+	filesystems := NewFilesystems(config, mounts)
+
+	var links *Links
+	if config.followsymlinks {
+		links = NewLinks()
+	}
 
-	go func() {
+	// - drives that are mounted already are crawled like configured directories, mounts that come and
+	// go later on are found by reading mountinfo again every POLL_TICK
+	for _, mount := range mounts {
+		filesystems.Automount(mount)
+	}
+	config.directories = filesystems.Roots()
+
+	// - maps directory paths to their *DirEntry, so that events can be applied to the directory
+	// they belong to
+	direntries := new(sync.Map)
+
+	// - when we have an index from a previous run, we merge it into mem right away so that the view
+	// has something to show, and then reconcile it with what is on disk below, directories that are
+	// in the index are not visited again
+	var known []*DirEntry
+	if config.index != "" {
+		loaded, loaderr := LoadIndex(config.index)
+		if loaderr != nil {
+			if !os.IsNotExist(loaderr) {
+				log.Println("could not load index:", loaderr)
+			}
+		} else {
+			known = filterIndex(config, exclusions, filesystems, loaded)
+			stats.Directories(len(known))
+
+			var batch []*FileEntry
+			for _, direntry := range known {
+				direntry.forcepoll = filesystems.Polled(direntry.path)
+				links.Restore(direntry)
+				direntries.Store(direntry.path, direntry)
+				poller.Add(direntry, time.Now())
+
+				stats.Indexed(direntry.files)
+				batch = append(batch, direntry.files...)
+				if direntry.self != nil {
+					batch = append(batch, direntry.self)
+				}
+				if len(batch) >= SPLIT_ENTRYTHRESHOLD {
+					mergeFiles(mem, batch)
+					batch = nil
+				}
+			}
+			mergeFiles(mem, batch)
+			log.Println("loaded", len(known), "directories from index")
+		}
+	}
+
+	spawn(func() {
 		for {
 			select {
 			case dir := <-newdirs:
-				watcherror := watcher.Add(dir)
-				if watcherror != nil {
-					//log.Println("could not start watching directory for changes", dir, watcherror)
-				} else {
-					wg.Add(1)
-					maxproc <- struct{}{}
+				// - whoever sends a directory to newdirs calls wg.Add(1) before sending, so that wg can
+				// not reach zero while a directory is on its way to be visited, the visit then calls
+				// wg.Done() when it is finished, or we call it here if we don't visit the directory
+				// - a new directory may be found by inotify and by updating its parent at the same
+				// time, so we make sure that we visit every directory only once
+				if _, known := direntries.Load(dir); known {
+					wg.Done()
+					break
+				}
 
-					direntry := &DirEntry{
-						inotify: false,
-					}
+				// - mount points below a root are where we may cross onto a filesystem we should not crawl
+				if !filesystems.Allowed(dir) {
+					journal.Visited(dir, nil)
+					wg.Done()
+					break
+				}
 
-					go visit(wg, config, watcher, maxwatch, maxproc, newdirs, collect, direntry, dir)
-					direntries = append(direntries, direntry)
+				select {
+				case maxproc <- struct{}{}:
+				case <-ctx.Done():
+					wg.Done()
+					return
+				}
+
+				direntry := &DirEntry{
+					path:      dir,
+					inotify:   false,
+					forcepoll: filesystems.Polled(dir),
+					linked:    links.Linked(dir),
 				}
 
-			case <-finish:
+				direntries.Store(dir, direntry)
+				stats.Queued()
+				stats.Directories(1)
+				spawn(func() {
+					visit(ctx, wg, config, exclusions, links, watches, poller, stats, journal, maxproc, newdirs, collect, direntry, dir)
+				})
+
+			case <-ctx.Done():
 				return
 			}
 		}
-	}()
+	})
 
-	go collectByName(wg, mem, collect, finish)
-	go collectByDir(wg, mem, collect, finish)
-	go collectByModTime(wg, mem, collect, finish)
-	go collectBySize(wg, mem, collect, finish)
+	// - progress is published twice per second, when nobody is listening we just drop the snapshot
+	// instead of blocking the crawler
+	spawn(func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-time.After(500 * time.Millisecond):
+				select {
+				case progress <- stats.Progress(watches.Len(), now):
+				default:
+				}
+			}
+		}
+	})
+
+	for i, files := range collect {
+		sortcolumn, files := SortColumn(i), files
+		spawn(func() { collectColumn(ctx, wg, mem, sortcolumn, files) })
+	}
 
 	for _, dir := range config.directories {
-		newdirs <- dir
-		wg.Done()
+		sendDir(ctx, wg, newdirs, dir)
+	}
+
+	if len(known) > 0 {
+		numentries := make(map[string]int, len(known))
+		for _, direntry := range known {
+			numentries[direntry.path] += len(direntry.files)
+			numentries[path.Dir(direntry.path)] += 1
+		}
+
+		for _, direntry := range known {
+			if ctx.Err() != nil {
+				break
+			}
+			reconcileDirectory(ctx, wg, mem, exclusions, links, direntries, watches, stats, journal, newdirs, direntry, numentries[direntry.path])
+		}
 	}
 
 	wg.Done()
 	wg.Wait()
 
-	const (
-		pollparts        = 6
-		polldirsoncount  = 5
-		pollfilesoncount = 20
-	)
-	polldirscounter := 0
-	pollfilescounter := 0
-	offset := 0
+	// - an index of a crawl that was cancelled halfway is missing directories that would never be found
+	// again while their parents don't change, so we don't save it
+	if ctx.Err() != nil {
+		return
+	}
+	stats.Done()
+
+	// - summing up the sizes below every directory walks all entries, so after the initial crawl it is
+	// only done again every once in a while when something changed
+	if config.recursivesize {
+		updateRecursiveSizes(direntries)
+	}
+	lastsizes := time.Now()
+	sizeschanged := false
+
+	// - the thresholds of the modification time buckets are relative to when they were made, so they are
+	// moved along every ROLL_INTERVAL
+	lastroll := time.Now()
+
+	saveIndex := func() {
+		if config.index != "" {
+			if saveerr := SaveIndex(config.index, direntries); saveerr != nil {
+				log.Println("could not save index:", saveerr)
+			}
+		}
+		if saveerr := journal.Save(); saveerr != nil {
+			log.Println("could not save journal:", saveerr)
+		}
+	}
+	saveIndex()
+	lastsave := time.Now()
+	indexchanged := false
+
+	// - directories and files that were moved are paired up after all updates of a batch were done
+	moves := NewMoves()
+
+	// - hooks only run for changes that were recorded after the initial crawl
+	hooks.Start(ctx, HOOKS_MAXPROC, spawn)
+	hookssince := time.Now()
+
 	for {
 		select {
-		case <-finish:
+		case <-ctx.Done():
+			if indexchanged {
+				saveIndex()
+			}
 			return
-		case <-time.After(10000 * time.Millisecond):
-			now := time.Now()
+		case dir := <-rescan:
+			// - an empty dir rescans all configured directories, roots that we don't know yet, because
+			// they did not exist or could not be read before, are visited like on startup
+			roots := filesystems.Roots()
+			dirs := []string{dir}
+			if dir == "" {
+				dirs = roots
+			}
 
-			polldirscounter += 1
-			pollfilescounter += 1
-			if polldirscounter >= polldirsoncount {
-				pollfiles := false
-				if pollfilescounter > pollfilesoncount {
-					pollfiles = true
+			start := time.Now()
+			updated := 0
+			for _, dir := range dirs {
+				isroot := false
+				for _, root := range roots {
+					isroot = isroot || root == dir
 				}
 
-				for _, direntry := range direntries {
-					if !direntry.inotify {
-						dirinfo, statdirerr := os.Lstat(direntry.path)
-
-						if statdirerr != nil {
-							//fmt.Println("poll found removed dir", direntry.path)
-							queueEvent(eventqueue, direntry.path, dirinfo, fsnotify.Remove)
-						} else {
-							dirmodtime := dirinfo.ModTime()
-							if dirmodtime.After(direntry.modtime) {
-								//fmt.Println("poll found updated dir", direntry.path)
-								queueEvent(eventqueue, direntry.path, dirinfo, fsnotify.Write)
-							} else if pollfiles && len(direntry.files) > 0 {
-
-								start := offset
-								inc := pollparts
-								if len(direntry.files) < pollparts {
-									start = 0
-									inc = 1
-								}
-
-							statfilesloop:
-								for i := start; i < len(direntry.files); i += inc {
-									fileentry := direntry.files[i]
-
-									filepath := path.Join(fileentry.dir, fileentry.name)
-									fileinfo, statfileerr := os.Lstat(filepath)
-
-									if statfileerr != nil {
-										//fmt.Println("poll found removed file:", filepath)
-										queueEvent(eventqueue, filepath, fileinfo, fsnotify.Remove)
-									} else {
-										filemodtime := fileinfo.ModTime()
-										if filemodtime.After(fileentry.modtime) {
-											//fmt.Println("poll found updated file:", filepath, direntry.path)
-											queueEvent(eventqueue, direntry.path, dirinfo, fsnotify.Write)
-											break statfilesloop
-										}
-									}
-								}
-							}
-						}
-					}
+				if _, known := direntries.Load(dir); known {
+					updated += rescanDirectory(ctx, wg, mem, exclusions, links, direntries, watches, stats, journal, newdirs, dir)
+				} else if isroot {
+					sendDir(ctx, wg, newdirs, dir)
+				} else {
+					log.Println("can not rescan unknown directory", dir)
 				}
+			}
+			log.Println("rescanned", updated, "directories in", time.Since(start))
+			indexchanged = true
+			sizeschanged = true
+		case <-time.After(POLL_TICK):
+			now := time.Now()
 
-				offset += 1
-				if offset >= pollparts {
-					offset = 0
+			if config.maxinotify <= 0 {
+				watches.SetLimit(readInotifyLimit())
+			}
+
+			if mounts, mountserr := ReadMountInfo(); mountserr == nil {
+				if updateMounts(ctx, wg, mem, exclusions, links, direntries, watches, stats, newdirs, filesystems, mounts) {
+					indexchanged = true
+					sizeschanged = true
 				}
+			}
+
+			if indexchanged && now.Sub(lastsave) > 10*time.Minute {
+				saveIndex()
+				lastsave = now
+				indexchanged = false
+			}
+
+			if config.recursivesize && sizeschanged && now.Sub(lastsizes) > 10*time.Second {
+				updateRecursiveSizes(direntries)
+				lastsizes = now
+				sizeschanged = false
+			}
 
-				polldirscounter = 0
-				if pollfiles {
-					pollfilescounter = 0
+			if now.Sub(lastroll) > ROLL_INTERVAL {
+				for i := range mem.columns {
+					mem.Column(SortColumn(i)).Roll(SortColumn(i), now)
 				}
+				lastroll = now
 			}
 
+			poller.Poll(direntries, eventqueue, now, int(int64(poller.rate)*int64(POLL_TICK)/int64(time.Second)))
+
 			currentevents := make([]Events, 0, 100)
 			eventqueue.Range(func(name, events interface{}) bool {
 				ops := events.(*Events).ops
@@ -576,8 +1213,9 @@ func Crawler(wg *sync.WaitGroup, mem ResultMemory, config Configuration, newdirs
 					lastchange := events.(*Events).timestamps[len(timestamps)-1]
 
 					if lastchange.Before(now.Add(-time.Millisecond * 500)) {
-						currentevents = append(currentevents, *events.(*Events))
-						eventqueue.Delete(name)
+						if eventqueue.CompareAndDelete(name, events) {
+							currentevents = append(currentevents, *events.(*Events))
+						}
 					}
 				}
 				return true
@@ -591,18 +1229,17 @@ func Crawler(wg *sync.WaitGroup, mem ResultMemory, config Configuration, newdirs
 			// Rename -> REMOVE
 			const (
 				UPDATE int = iota
-				NEWDIR
 				REMOVE
 			)
 
 			if len(currentevents) > 0 {
-				//fmt.Println(now)
+				// - events are either about a directory that we know, or about a file or new directory
+				// inside a directory that we know, in both cases we update the directory that contains
+				// the changes, new directories are then found when the containing directory is read
+				updates := make(map[string]bool)
 				for _, events := range currentevents {
-					//fmt.Print(events.name, ": ", len(events.ops))
-
 					action := UPDATE
 					for _, op := range events.ops {
-						//fmt.Print(", ", op.String())
 						if op == fsnotify.Remove || op == fsnotify.Rename {
 							action = REMOVE
 						} else {
@@ -610,17 +1247,58 @@ func Crawler(wg *sync.WaitGroup, mem ResultMemory, config Configuration, newdirs
 						}
 					}
 
+					_, isdir := direntries.Load(events.name)
 					switch action {
 					case UPDATE:
-						//fmt.Println(" -> UPDATE")
-					case NEWDIR:
-						//fmt.Println(" -> NEWDIR")
+						if isdir {
+							updates[events.name] = true
+						} else {
+							updates[path.Dir(events.name)] = true
+						}
 					case REMOVE:
-						//fmt.Println(" -> REMOVE")
+						if isdir {
+							moves.Vanished(events.name)
+						}
+						updates[path.Dir(events.name)] = true
 					}
 				}
+
+				// - a directory that changed becomes the most recently changed watched directory, or gets
+				// promoted from polling to inotify if it was polled
+				for dir := range updates {
+					if value, ok := direntries.Load(dir); ok {
+						watches.Promote(value.(*DirEntry))
+						updateDirectory(ctx, wg, mem, exclusions, links, direntries, watches, stats, journal, newdirs, moves, value.(*DirEntry))
+					}
+				}
+
+				if moveddirs, movedfiles := moves.Apply(ctx, wg, mem, exclusions, links, direntries, watches, poller, stats, journal, newdirs, now); moveddirs+movedfiles > 0 {
+					log.Println("moved", moveddirs, "directories and", movedfiles, "files")
+				}
+
+				indexchanged = true
+				sizeschanged = true
 				currentevents = currentevents[:0]
 			}
+
+			// - the contents of a new directory are recorded when it is visited, which is usually after the
+			// batch in which it was created, so hooks run for everything that was recorded since they ran
+			// last, changes recorded while we query are left for the next tick
+			if kinds := hooks.Kinds(); kinds != 0 {
+				until := time.Now()
+				var changes []Change
+				for _, change := range journal.Query("", kinds, hookssince) {
+					if change.time.Before(until) {
+						changes = append(changes, change)
+					}
+				}
+				hookssince = until
+
+				for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+					changes[i], changes[j] = changes[j], changes[i]
+				}
+				hooks.Run(changes)
+			}
 		}
 	}
 }
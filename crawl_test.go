@@ -1,6 +1,10 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
 	"os"
 	"path"
 	//"log"
@@ -10,6 +14,7 @@ import (
 	"sync"
 	"time"
 
+	fsnotify "github.com/fsnotify/fsnotify"
 	"github.com/gotk3/gotk3/gtk"
 
 	"testing"
@@ -21,32 +26,20 @@ func TestFileEntries(t *testing.T) {
 	}
 	log.Println("running TestFileEntries")
 
-	mem := ResultMemory{
-		new(FileEntries),
-		new(FileEntries),
-		new(FileEntries),
-		new(FileEntries),
-	}
+	mem := NewSliceMemory()
 	config := Configuration{
 		cores:       runtime.NumCPU(),
 		directories: []string{os.Getenv("HOME"), "/usr", "/var", "/sys", "/opt", "/etc", "/bin", "/sbin"},
 		maxinotify:  1024,
 	}
-	newdirs := make(chan string)
-	crawlerquery := make(chan *regexp.Regexp)
-	finish := make(chan struct{})
 
-	var wg sync.WaitGroup
 	log.Println("starting Crawl on", config.cores, "cores")
-	wg.Add(1)
-	go Crawler(&wg, mem, config, newdirs, crawlerquery, finish)
-	wg.Wait()
-	close(finish)
+	startCrawler(testCrawler{mem: mem, config: config}).stop()
 	log.Println("Crawl terminated")
 
 	searchterm := ".*\\.cc$"
 	query, _ := regexp.Compile(searchterm)
-	cache := MatchCaches{NewSimpleCache(), NewSimpleCache()}
+	cache := MatchCaches{NewSimpleCache(), NewSimpleCache(), FILTER_ALL}
 	abort := make(chan struct{})
 	taken := make(chan *FileEntry)
 
@@ -63,21 +56,21 @@ func TestFileEntries(t *testing.T) {
 	}
 
 	go taker(&byname)
-	mem.byname.Take(cache, SORT_BY_NAME, gtk.SORT_ASCENDING, query, 1000, abort, taken)
+	mem.columns[SORT_BY_NAME].Take(cache, SORT_BY_NAME, gtk.SORT_ASCENDING, query, 1000, abort, taken)
 
 	go taker(&bymodtime)
-	mem.bymodtime.Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, query, 1000, abort, taken)
+	mem.columns[SORT_BY_MODTIME].Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, query, 1000, abort, taken)
 
 	go taker(&bysize)
-	mem.bysize.Take(cache, SORT_BY_SIZE, gtk.SORT_ASCENDING, query, 1000, abort, taken)
+	mem.columns[SORT_BY_SIZE].Take(cache, SORT_BY_SIZE, gtk.SORT_ASCENDING, query, 1000, abort, taken)
 
-	log.Println("len(byname):", len(byname), mem.byname.NumFiles())
-	log.Println("len(bymodtime):", len(bymodtime), mem.bymodtime.NumFiles())
-	log.Println("len(bysize):", len(bysize), mem.bysize.NumFiles())
+	log.Println("len(byname):", len(byname), mem.columns[SORT_BY_NAME].NumFiles())
+	log.Println("len(bymodtime):", len(bymodtime), mem.columns[SORT_BY_MODTIME].NumFiles())
+	log.Println("len(bysize):", len(bysize), mem.columns[SORT_BY_SIZE].NumFiles())
 
-	//Print(mem.byname.(*NameBucket), 0)
-	//Print(mem.bymodtime.(*ModTimeBucket), 0)
-	//Print(mem.bysize.(*SizeBucket), 0)
+	//Print(mem.columns[SORT_BY_NAME].(*NameBucket), 0)
+	//Print(mem.columns[SORT_BY_MODTIME].(*ModTimeBucket), 0)
+	//Print(mem.columns[SORT_BY_SIZE].(*SizeBucket), 0)
 
 	log.Println("TestFileEntries finished")
 }
@@ -85,31 +78,18 @@ func TestFileEntries(t *testing.T) {
 func BenchmarkCrawlLargeSlice(b *testing.B) {
 	b.StopTimer()
 
-	mem := ResultMemory{
-		new(FileEntries),
-		new(FileEntries),
-		new(FileEntries),
-		new(FileEntries),
-	}
+	mem := NewSliceMemory()
 	config := Configuration{
 		cores:       runtime.NumCPU(),
 		directories: []string{path.Join(os.Getenv("GOPATH"))},
 		maxinotify:  1024,
 	}
-	newdirs := make(chan string)
-	crawlerquery := make(chan *regexp.Regexp)
 
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
-		finish := make(chan struct{})
-		var wg sync.WaitGroup
-		wg.Add(1)
-		go Crawler(&wg, mem, config, newdirs, crawlerquery, finish)
-		time.Sleep(10 * time.Millisecond)
-		wg.Wait()
-		close(finish)
+		startCrawler(testCrawler{mem: mem, config: config}).stop()
 
-		cache := MatchCaches{NewSimpleCache(), NewSimpleCache()}
+		cache := MatchCaches{NewSimpleCache(), NewSimpleCache(), FILTER_ALL}
 		abort := make(chan struct{})
 		taken := make(chan *FileEntry)
 
@@ -123,40 +103,27 @@ func BenchmarkCrawlLargeSlice(b *testing.B) {
 		}
 
 		go taker(&bymodtime)
-		mem.bymodtime.Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, nil, 10, abort, taken)
-		mem.bymodtime.Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, nil, 100, abort, taken)
-		mem.bymodtime.Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, nil, 1000, abort, taken)
+		mem.columns[SORT_BY_MODTIME].Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, nil, 10, abort, taken)
+		mem.columns[SORT_BY_MODTIME].Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, nil, 100, abort, taken)
+		mem.columns[SORT_BY_MODTIME].Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, nil, 1000, abort, taken)
 	}
 }
 
 func BenchmarkCrawlBuckets(b *testing.B) {
 	b.StopTimer()
 
-	mem := ResultMemory{
-		NewNameBucket(),
-		NewDirBucket(),
-		NewModTimeBucket(),
-		NewSizeBucket(),
-	}
+	mem := NewResultMemory()
 	config := Configuration{
 		cores:       runtime.NumCPU(),
 		directories: []string{path.Join(os.Getenv("GOPATH"))},
 		maxinotify:  1024,
 	}
-	newdirs := make(chan string)
-	crawlerquery := make(chan *regexp.Regexp)
 
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
-		finish := make(chan struct{})
-		var wg sync.WaitGroup
-		wg.Add(1)
-		go Crawler(&wg, mem, config, newdirs, crawlerquery, finish)
-		time.Sleep(10 * time.Millisecond)
-		wg.Wait()
-		close(finish)
+		startCrawler(testCrawler{mem: mem, config: config}).stop()
 
-		cache := MatchCaches{NewSimpleCache(), NewSimpleCache()}
+		cache := MatchCaches{NewSimpleCache(), NewSimpleCache(), FILTER_ALL}
 		abort := make(chan struct{})
 		taken := make(chan *FileEntry)
 
@@ -170,8 +137,687 @@ func BenchmarkCrawlBuckets(b *testing.B) {
 		}
 
 		go taker(&bymodtime)
-		mem.bymodtime.Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, nil, 10, abort, taken)
-		mem.bymodtime.Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, nil, 100, abort, taken)
-		mem.bymodtime.Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, nil, 1000, abort, taken)
+		mem.columns[SORT_BY_MODTIME].Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, nil, 10, abort, taken)
+		mem.columns[SORT_BY_MODTIME].Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, nil, 100, abort, taken)
+		mem.columns[SORT_BY_MODTIME].Take(cache, SORT_BY_MODTIME, gtk.SORT_ASCENDING, nil, 1000, abort, taken)
+	}
+}
+
+// - the heap that is in use after a garbage collection
+func heapInUse() uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// - everything the crawler keeps for every file, the entry, its place in every column and the directories
+func BenchmarkCrawlMemory(b *testing.B) {
+	b.StopTimer()
+
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	numfiles := generateTree(b, root, 3, 8, 50)
+	config := Configuration{
+		cores:       runtime.NumCPU(),
+		directories: []string{root},
+		maxinotify:  1024,
+	}
+
+	var bytes uint64
+	for i := 0; i < b.N; i++ {
+		mem := NewResultMemory()
+		before := heapInUse()
+
+		b.StartTimer()
+		crawler := startCrawler(testCrawler{mem: mem, config: config})
+		b.StopTimer()
+
+		if after := heapInUse(); after > before {
+			bytes += after - before
+		}
+
+		// - the crawler has to be gone before the next iteration measures the heap again
+		crawler.stop()
+		runtime.KeepAlive(mem)
+	}
+
+	b.ReportMetric(float64(bytes)/float64(b.N)/float64(numfiles), "bytes/file")
+}
+
+// - only what the columns need for every file, the entries exist before they are merged
+func BenchmarkColumnsMemory(b *testing.B) {
+	b.StopTimer()
+
+	files := generateFileEntries(10*SPLIT_ENTRYTHRESHOLD, 1)
+
+	var bytes uint64
+	for i := 0; i < b.N; i++ {
+		mem := NewResultMemory()
+		before := heapInUse()
+
+		b.StartTimer()
+		mergeFiles(mem, files)
+		for sortcolumn := range mem.columns {
+			mem.columns[sortcolumn].(*Node).Sort(SortColumn(sortcolumn))
+		}
+		b.StopTimer()
+
+		if after := heapInUse(); after > before {
+			bytes += after - before
+		}
+		removeFiles(mem, files)
+	}
+
+	b.ReportMetric(float64(bytes)/float64(b.N)/float64(len(files)), "bytes/file")
+}
+
+// - generates a tree of directories that are depth levels deep, every directory has width subdirectories
+// and numfiles files, returns the number of files
+func generateTree(tb testing.TB, dir string, depth int, width int, numfiles int) int {
+	generated := 0
+	for i := 0; i < numfiles; i++ {
+		if err := ioutil.WriteFile(path.Join(dir, fmt.Sprintf("file%04d.txt", i)), nil, 0644); err != nil {
+			tb.Fatal(err)
+		}
+		generated += 1
+	}
+
+	if depth > 0 {
+		for i := 0; i < width; i++ {
+			subdir := path.Join(dir, fmt.Sprintf("dir%04d", i))
+			if err := os.Mkdir(subdir, 0755); err != nil {
+				tb.Fatal(err)
+			}
+			generated += generateTree(tb, subdir, depth-1, width, numfiles)
+		}
+	}
+
+	return generated
+}
+
+// - runs Crawler for a test, a test only sets mem, config and the channels and state it looks at, the
+// rest is made by startCrawler, which returns once the initial crawl finished
+// - stop cancels the crawler and waits until it returned, so that none of its goroutines are still
+// running when the next test starts
+type testCrawler struct {
+	mem         ResultMemory
+	config      Configuration
+	newdirs     chan string
+	rescan      chan string
+	query       chan *regexp.Regexp
+	progress    chan CrawlProgress
+	crawlerrors *CrawlErrors
+	journal     *Journal
+
+	cancel   context.CancelFunc
+	returned chan struct{}
+}
+
+func startCrawler(crawler testCrawler) *testCrawler {
+	if crawler.newdirs == nil {
+		crawler.newdirs = make(chan string)
+	}
+	if crawler.query == nil {
+		crawler.query = make(chan *regexp.Regexp)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	crawler.cancel = cancel
+	crawler.returned = make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer close(crawler.returned)
+		Crawler(ctx, &wg, crawler.mem, crawler.config, crawler.newdirs, crawler.rescan, crawler.query, crawler.progress, crawler.crawlerrors, crawler.journal)
+	}()
+	wg.Wait()
+
+	return &crawler
+}
+
+func (crawler *testCrawler) stop() {
+	crawler.cancel()
+	<-crawler.returned
+}
+
+func benchmarkReadTree(b *testing.B, read func(dir string) ([]*FileEntry, []string)) {
+	b.StopTimer()
+
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	numfiles := generateTree(b, root, 3, 8, 50)
+
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		found := 0
+		dirs := []string{root}
+		for len(dirs) > 0 {
+			dir := dirs[len(dirs)-1]
+			dirs = dirs[:len(dirs)-1]
+
+			fileentries, subdirs := read(dir)
+			found += len(fileentries)
+			dirs = append(dirs, subdirs...)
+		}
+
+		if found != numfiles {
+			b.Fatal("expected", numfiles, "files, found", found)
+		}
+	}
+}
+
+// - how we read directories before, ioutil.ReadDir lstats every entry, including subdirectories
+func BenchmarkReadTreeLstat(b *testing.B) {
+	benchmarkReadTree(b, func(dir string) ([]*FileEntry, []string) {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		var fileentries []*FileEntry
+		var subdirs []string
+		for _, fileinfo := range infos {
+			if fileinfo.IsDir() {
+				subdirs = append(subdirs, path.Join(dir, fileinfo.Name()))
+			} else {
+				fileentries = append(fileentries, &FileEntry{direntry: &DirEntry{path: dir}, name: fileinfo.Name(), modtime: fileinfo.ModTime(), size: fileinfo.Size()})
+			}
+		}
+		return fileentries, subdirs
+	})
+}
+
+func BenchmarkReadTreeGetdents(b *testing.B) {
+	benchmarkReadTree(b, func(dir string) ([]*FileEntry, []string) {
+		_, fileentries, subdirs, err := readDir(nil, nil, nil, &DirEntry{path: dir})
+		if err != nil {
+			b.Fatal(err)
+		}
+		return fileentries, subdirs
+	})
+}
+
+// - only listing directories, this is how long it takes until every subdirectory has been routed to newdirs
+func BenchmarkListTreeGetdents(b *testing.B) {
+	benchmarkReadTree(b, func(dir string) ([]*FileEntry, []string) {
+		_, names, subdirs, err := listDir(nil, nil, dir)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		fileentries := make([]*FileEntry, len(names))
+		return fileentries, subdirs
+	})
+}
+
+func BenchmarkCrawlGeneratedTree(b *testing.B) {
+	b.StopTimer()
+
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	numfiles := generateTree(b, root, 3, 8, 50)
+
+	// - every directory is indexed as a row too
+	numdirs := 1 + 8 + 8*8 + 8*8*8
+
+	config := Configuration{
+		cores:       runtime.NumCPU(),
+		directories: []string{root},
+		maxinotify:  1024,
+	}
+
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		mem := NewResultMemory()
+		startCrawler(testCrawler{mem: mem, config: config}).stop()
+
+		if mem.columns[SORT_BY_NAME].NumFiles() != numfiles+numdirs {
+			b.Fatal("expected", numfiles+numdirs, "entries, crawled", mem.columns[SORT_BY_NAME].NumFiles())
+		}
+	}
+}
+
+func TestCrawlerCancel(t *testing.T) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	generateTree(t, root, 3, 6, 20)
+
+	config := Configuration{
+		cores:       runtime.NumCPU(),
+		directories: []string{root},
+		maxinotify:  1024,
+	}
+
+	seed := time.Now().UnixNano()
+	log.Println("TestCrawlerCancel seed", seed)
+	random := rand.New(rand.NewSource(seed))
+
+	before := runtime.NumGoroutine()
+
+	// - we cancel right away, somewhere in the middle of the initial crawl, or after it finished, the
+	// crawler must return in every case, and wg must reach zero
+	for i := 0; i < 20; i++ {
+		mem := NewResultMemory()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		wg.Add(1)
+		returned := make(chan struct{})
+		go func() {
+			Crawler(ctx, &wg, mem, config, make(chan string), make(chan string), make(chan *regexp.Regexp), make(chan CrawlProgress), nil, nil)
+			close(returned)
+		}()
+
+		time.Sleep(time.Duration(random.Int63n(int64(50 * time.Millisecond))))
+		cancel()
+
+		waited := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(waited)
+		}()
+
+		for _, done := range []chan struct{}{returned, waited} {
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				buf := make([]byte, 1<<20)
+				t.Fatal("crawler did not shut down after cancel:\n", string(buf[:runtime.Stack(buf, true)]))
+			}
+		}
+	}
+
+	// - goroutines that already returned may not have been cleaned up yet
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if after := runtime.NumGoroutine(); after > before {
+		buf := make([]byte, 1<<20)
+		t.Error("leaked", after-before, "goroutines:\n", string(buf[:runtime.Stack(buf, true)]))
+	}
+
+	log.Println("TestCrawlerCancel finished")
+}
+
+func TestUpdateDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name string, size int) {
+		if err := ioutil.WriteFile(path.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile("a", 10)
+	writeFile("b", 20)
+	writeFile("c", 30)
+	if err := os.Mkdir(path.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	mem := NewResultMemory()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	watches := NewWatches(watcher, 1024, nil)
+	newdirs := make(chan string, 10)
+	direntries := new(sync.Map)
+	direntry := &DirEntry{path: dir}
+	direntries.Store(dir, direntry)
+
+	updateDirectory(context.Background(), new(sync.WaitGroup), mem, nil, nil, direntries, watches, nil, nil, newdirs, nil, direntry)
+	if len(direntry.files) != 3 {
+		t.Error("expected 3 files after first update, got", len(direntry.files))
+	}
+	if subdir := <-newdirs; subdir != path.Join(dir, "sub") {
+		t.Error("expected sub to be send to newdirs, got", subdir)
+	}
+
+	subentry := &DirEntry{
+		path:  path.Join(dir, "sub"),
+		files: []*FileEntry{{direntry: &DirEntry{path: path.Join(dir, "sub")}, name: "x", modtime: time.Now(), size: 1}},
+	}
+	direntries.Store(subentry.path, subentry)
+	mergeFiles(mem, subentry.files)
+
+	writeFile("b", 2000)
+	writeFile("d", 40)
+	if err := os.Remove(path.Join(dir, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(path.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+
+	updateDirectory(context.Background(), new(sync.WaitGroup), mem, nil, nil, direntries, watches, nil, nil, newdirs, nil, direntry)
+
+	if _, known := direntries.Load(subentry.path); known {
+		t.Error("removed subdirectory is still known")
+	}
+
+	if direntry.self == nil || direntry.self.name != path.Base(dir) || !direntry.self.IsDir() {
+		t.Error("expected a row for the directory itself, got", direntry.self)
+	}
+
+	// - three files and the row of the directory itself
+	for _, sortcolumn := range []SortColumn{SORT_BY_NAME, SORT_BY_DIR, SORT_BY_MODTIME, SORT_BY_SIZE} {
+		result := mem.Column(sortcolumn)
+		if result.NumFiles() != 4 {
+			t.Error("expected 4 entries in column", sortcolumn, "got", result.NumFiles())
+		}
+
+		sizes := make(map[string]int64)
+		result.(*Node).Sort(sortcolumn)
+		WalkEntries(result.(*Node), gtk.SORT_ASCENDING, func(entry *FileEntry) bool {
+			if entry != nil {
+				sizes[entry.name] = entry.size
+			}
+			return true
+		})
+
+		if _, ok := sizes["a"]; ok {
+			t.Error("removed file a still in column", sortcolumn)
+		}
+		if sizes["b"] != 2000 || sizes["c"] != 30 || sizes["d"] != 40 {
+			t.Error("unexpected entries in column", sortcolumn, sizes)
+		}
+	}
+}
+
+func TestRescanDirectory(t *testing.T) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, subdir := range []string{"a", "b"} {
+		if err := os.Mkdir(path.Join(root, subdir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(root, subdir, "x"), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mem := NewResultMemory()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	watches := NewWatches(watcher, 1024, nil)
+	newdirs := make(chan string, 10)
+	direntries := new(sync.Map)
+	for _, dir := range []string{root, path.Join(root, "a"), path.Join(root, "b")} {
+		direntry := &DirEntry{path: dir}
+		dirinfo, fileentries, _, err := readDir(nil, nil, nil, direntry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		direntry.modtime, direntry.files = dirinfo.ModTime(), fileentries
+		direntries.Store(dir, direntry)
+		mergeFiles(mem, fileentries)
+	}
+
+	// - changing the modtime of a file does not change the modtime of its directory, so only a
+	// rescan finds this change
+	changed := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path.Join(root, "a", "x"), changed, changed); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(path.Join(root, "b")); err != nil {
+		t.Fatal(err)
+	}
+
+	if updated := rescanDirectory(context.Background(), new(sync.WaitGroup), mem, nil, nil, direntries, watches, nil, nil, newdirs, root); updated != 2 {
+		t.Error("expected 2 directories to be rescanned, got", updated)
+	}
+
+	if _, known := direntries.Load(path.Join(root, "b")); known {
+		t.Error("removed directory b is still known")
+	}
+
+	for _, sortcolumn := range []SortColumn{SORT_BY_NAME, SORT_BY_DIR, SORT_BY_MODTIME, SORT_BY_SIZE} {
+		var files []*FileEntry
+		dirs := make(map[string]bool)
+		for _, entry := range takeAll(mem.Column(sortcolumn), sortcolumn, DEFAULT_DIRECTION, nil, 100) {
+			if entry.IsDir() {
+				dirs[path.Join(entry.Dir(), entry.name)] = true
+			} else {
+				files = append(files, entry)
+			}
+		}
+
+		if len(files) != 1 || files[0].Dir() != path.Join(root, "a") || !files[0].modtime.Equal(changed) {
+			t.Error("unexpected entries in column", sortcolumn, "after rescan:", files)
+		}
+		if len(dirs) != 2 || !dirs[root] || !dirs[path.Join(root, "a")] {
+			t.Error("unexpected directories in column", sortcolumn, "after rescan:", dirs)
+		}
+	}
+
+	log.Println("TestRescanDirectory finished")
+}
+
+func generateFileEntries(n int, seed int64) []*FileEntry {
+	r := rand.New(rand.NewSource(seed))
+	now := time.Now()
+
+	dirs := make([]*DirEntry, 50)
+	for i := range dirs {
+		dirs[i] = &DirEntry{path: fmt.Sprintf("/tmp/dir%02d", i)}
+	}
+
+	files := make([]*FileEntry, n)
+	for i := range files {
+		// - few distinct sizes and modtimes, so that there are lots of entries that compare equal
+		files[i] = &FileEntry{
+			direntry: dirs[r.Intn(len(dirs))],
+			name:     fmt.Sprintf("%c%06d.txt", 'a'+r.Intn(26), i),
+			modtime:  now.Add(-time.Duration(r.Intn(1000)) * time.Hour),
+			size:     int64(r.Intn(100)) * 4096,
+		}
+	}
+
+	return files
+}
+
+func takeAll(result CrawlResult, sortcolumn SortColumn, direction gtk.SortType, query *regexp.Regexp, n int) []*FileEntry {
+	cache := MatchCaches{NewSimpleCache(), NewSimpleCache(), FILTER_ALL}
+	abort := make(chan struct{})
+	taken := make(chan *FileEntry)
+	done := make(chan struct{})
+
+	var entries []*FileEntry
+	go func() {
+		for entry := range taken {
+			if entry == nil {
+				close(done)
+				return
+			}
+			entries = append(entries, entry)
+		}
+	}()
+
+	result.Take(cache, sortcolumn, direction, query, n, abort, taken)
+	<-done
+
+	return entries
+}
+
+func TestCrawlResults(t *testing.T) {
+	// - the same files are merged into every result, so they all share one table
+	table := NewEntryTable()
+	backends := []struct {
+		name string
+		new  func(sortcolumn SortColumn) CrawlResult
+	}{
+		{"FileEntries", func(_ SortColumn) CrawlResult { return NewFileEntries(table) }},
+		{"Node", func(sortcolumn SortColumn) CrawlResult { return NewBucket(sortcolumn, table) }},
+	}
+
+	files := generateFileEntries(3*SPLIT_ENTRYTHRESHOLD, 1)
+	query, _ := regexp.Compile("^[abc].*")
+
+	for _, backend := range backends {
+		for _, sortcolumn := range []SortColumn{SORT_BY_NAME, SORT_BY_DIR, SORT_BY_MODTIME, SORT_BY_SIZE} {
+			result := backend.new(sortcolumn)
+
+			// - merge in batches like the collectors do, every batch sorted by itself
+			for i := 0; i < len(files); i += 1000 {
+				batch := make([]*FileEntry, 1000)
+				copy(batch, files[i:i+1000])
+				sortFileEntries(sortcolumn, batch)
+				result.Merge(sortcolumn, batch)
+			}
+
+			if result.NumFiles() != len(files) {
+				t.Error(backend.name, sortcolumn, "NumFiles after Merge:", result.NumFiles(), "expected:", len(files))
+			}
+
+			ascending := takeAll(result, sortcolumn, gtk.SORT_ASCENDING, nil, len(files))
+			if len(ascending) != len(files) {
+				t.Error(backend.name, sortcolumn, "Take returned", len(ascending), "entries, expected:", len(files))
+			}
+			for i := 1; i < len(ascending); i++ {
+				if lessFileEntries(sortcolumn, ascending[i], ascending[i-1]) {
+					t.Error(backend.name, sortcolumn, "Take ascending not sorted at", i)
+					break
+				}
+			}
+
+			descending := takeAll(result, sortcolumn, gtk.SORT_DESCENDING, nil, 100)
+			if len(descending) != 100 {
+				t.Error(backend.name, sortcolumn, "Take descending returned", len(descending), "entries, expected: 100")
+			}
+			for i := 1; i < len(descending); i++ {
+				if lessFileEntries(sortcolumn, descending[i-1], descending[i]) {
+					t.Error(backend.name, sortcolumn, "Take descending not sorted at", i)
+					break
+				}
+			}
+
+			// - remove every third entry, the removed entries are copies, so that they can only be found
+			// by their dir and name, not by pointer
+			var removed []*FileEntry
+			removednames := make(map[string]bool)
+			for i := 0; i < len(files); i += 3 {
+				entry := &FileEntry{direntry: &DirEntry{path: files[i].Dir()}, name: files[i].name, modtime: files[i].modtime, size: files[i].size, mode: files[i].mode}
+				removed = append(removed, entry)
+				removednames[path.Join(entry.Dir(), entry.name)] = true
+			}
+			sortFileEntries(sortcolumn, removed)
+			result.Remove(sortcolumn, removed)
+
+			expected := len(files) - len(removed)
+			if result.NumFiles() != expected {
+				t.Error(backend.name, sortcolumn, "NumFiles after Remove:", result.NumFiles(), "expected:", expected)
+			}
+
+			remaining := takeAll(result, sortcolumn, gtk.SORT_ASCENDING, nil, len(files))
+			if len(remaining) != expected {
+				t.Error(backend.name, sortcolumn, "Take after Remove returned", len(remaining), "entries, expected:", expected)
+			}
+			for i, entry := range remaining {
+				if removednames[path.Join(entry.Dir(), entry.name)] {
+					t.Error(backend.name, sortcolumn, "Take after Remove returned removed entry", entry.Dir(), entry.name)
+					break
+				}
+				if i > 0 && lessFileEntries(sortcolumn, entry, remaining[i-1]) {
+					t.Error(backend.name, sortcolumn, "Take after Remove not sorted at", i)
+					break
+				}
+			}
+
+			// - removing entries that are not there anymore must not change anything
+			result.Remove(sortcolumn, removed)
+			if result.NumFiles() != expected {
+				t.Error(backend.name, sortcolumn, "NumFiles after removing twice:", result.NumFiles(), "expected:", expected)
+			}
+
+			matching := 0
+			for _, entry := range remaining {
+				if query.MatchString(entry.name) {
+					matching += 1
+				}
+			}
+			queried := takeAll(result, sortcolumn, gtk.SORT_ASCENDING, query, len(files))
+			if len(queried) != matching {
+				t.Error(backend.name, sortcolumn, "Take with query returned", len(queried), "entries, expected:", matching)
+			}
+		}
+	}
+
+	log.Println("TestCrawlResults finished")
+}
+
+func BenchmarkMergeRemove(b *testing.B) {
+	files := generateFileEntries(10*SPLIT_ENTRYTHRESHOLD, 1)
+	table := NewEntryTable()
+
+	benchmarks := []struct {
+		name    string
+		new     func() CrawlResult
+		sorting SortColumn
+	}{
+		{"SliceName", func() CrawlResult { return NewFileEntries(table) }, SORT_BY_NAME},
+		{"SliceModTime", func() CrawlResult { return NewFileEntries(table) }, SORT_BY_MODTIME},
+		{"SliceSize", func() CrawlResult { return NewFileEntries(table) }, SORT_BY_SIZE},
+		{"BucketName", func() CrawlResult { return NewBucket(SORT_BY_NAME, table) }, SORT_BY_NAME},
+		{"BucketModTime", func() CrawlResult { return NewBucket(SORT_BY_MODTIME, table) }, SORT_BY_MODTIME},
+		{"BucketSize", func() CrawlResult { return NewBucket(SORT_BY_SIZE, table) }, SORT_BY_SIZE},
+	}
+
+	for _, bm := range benchmarks {
+		var batches [][]*FileEntry
+		for i := 0; i < len(files); i += 1000 {
+			batch := make([]*FileEntry, 1000)
+			copy(batch, files[i:i+1000])
+			sortFileEntries(bm.sorting, batch)
+			batches = append(batches, batch)
+		}
+
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				result := bm.new()
+				for _, batch := range batches {
+					result.Merge(bm.sorting, batch)
+				}
+				for _, batch := range batches {
+					result.Remove(bm.sorting, batch)
+				}
+			}
+		})
 	}
 }
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	unix "golang.org/x/sys/unix"
+)
+
+const (
+	CRAWLERRORS_MAX int = 10000
+)
+
+// - a directory or file that could not be read or watched, errno is zero when the error did
+// not come from a syscall, path is empty for errors that are not about a specific path, like
+// an inotify queue overflow
+type CrawlError struct {
+	path  string
+	op    string
+	errno syscall.Errno
+	err   error
+	time  time.Time
+}
+
+func (crawlerror CrawlError) Error() string {
+	if crawlerror.path == "" {
+		return fmt.Sprintf("%s: %v", crawlerror.op, crawlerror.err)
+	}
+	return fmt.Sprintf("%s %s: %v", crawlerror.op, crawlerror.path, crawlerror.err)
+}
+
+// - the message of the error together with the name of its errno, like "permission denied (EACCES)"
+func (crawlerror CrawlError) Reason() string {
+	if crawlerror.errno != 0 {
+		return fmt.Sprintf("%s (%s)", crawlerror.errno.Error(), unix.ErrnoName(crawlerror.errno))
+	}
+	return crawlerror.err.Error()
+}
+
+// - keeps the most recent error for every path and operation, an error is cleared again when the path
+// could be read later on, so that Errors lists what is currently missing from the index, all methods
+// can be called on a nil *CrawlErrors
+type CrawlErrors struct {
+	mutex   sync.Mutex
+	records map[string]map[string]CrawlError
+	len     int
+	total   int64
+}
+
+func NewCrawlErrors() *CrawlErrors {
+	return &CrawlErrors{
+		records: make(map[string]map[string]CrawlError),
+	}
+}
+
+// - op is used for errors that don't tell us which operation failed, for *os.PathError and
+// *os.SyscallError we take the operation from the error itself
+func (crawlerrors *CrawlErrors) Add(path string, op string, err error) {
+	if crawlerrors == nil || err == nil {
+		return
+	}
+
+	var patherr *os.PathError
+	var syscallerr *os.SyscallError
+	if errors.As(err, &patherr) {
+		op = patherr.Op
+	} else if errors.As(err, &syscallerr) {
+		op = syscallerr.Syscall
+	}
+
+	var errno syscall.Errno
+	errors.As(err, &errno)
+
+	crawlerror := CrawlError{
+		path:  path,
+		op:    op,
+		errno: errno,
+		err:   err,
+		time:  time.Now(),
+	}
+	log.Println("error:", crawlerror)
+
+	crawlerrors.mutex.Lock()
+	defer crawlerrors.mutex.Unlock()
+
+	crawlerrors.total += 1
+
+	ops, ok := crawlerrors.records[path]
+	if !ok {
+		if crawlerrors.len >= CRAWLERRORS_MAX {
+			return
+		}
+		ops = make(map[string]CrawlError)
+		crawlerrors.records[path] = ops
+	}
+
+	if _, ok := ops[op]; !ok {
+		crawlerrors.len += 1
+	}
+	ops[op] = crawlerror
+}
+
+// - forget all errors about path, called when path could be read again
+func (crawlerrors *CrawlErrors) Clear(path string) {
+	if crawlerrors == nil {
+		return
+	}
+
+	crawlerrors.mutex.Lock()
+	defer crawlerrors.mutex.Unlock()
+
+	if ops, ok := crawlerrors.records[path]; ok {
+		crawlerrors.len -= len(ops)
+		delete(crawlerrors.records, path)
+	}
+}
+
+func (crawlerrors *CrawlErrors) Len() int {
+	if crawlerrors == nil {
+		return 0
+	}
+
+	crawlerrors.mutex.Lock()
+	defer crawlerrors.mutex.Unlock()
+	return crawlerrors.len
+}
+
+// - the number of errors that happened since the crawler started, including ones that were cleared
+func (crawlerrors *CrawlErrors) Total() int64 {
+	if crawlerrors == nil {
+		return 0
+	}
+
+	crawlerrors.mutex.Lock()
+	defer crawlerrors.mutex.Unlock()
+	return crawlerrors.total
+}
+
+// - returns a copy of the current errors, most recent first
+func (crawlerrors *CrawlErrors) Errors() []CrawlError {
+	if crawlerrors == nil {
+		return nil
+	}
+
+	crawlerrors.mutex.Lock()
+	result := make([]CrawlError, 0, crawlerrors.len)
+	for _, ops := range crawlerrors.records {
+		for _, crawlerror := range ops {
+			result = append(result, crawlerror)
+		}
+	}
+	crawlerrors.mutex.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].time.Equal(result[j].time) {
+			return result[i].path < result[j].path
+		}
+		return result[i].time.After(result[j].time)
+	})
+
+	return result
+}
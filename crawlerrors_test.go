@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"runtime"
+	"syscall"
+
+	"testing"
+)
+
+func TestCrawlErrors(t *testing.T) {
+	var nilerrors *CrawlErrors
+	nilerrors.Add("/a", "readdir", os.ErrPermission)
+	nilerrors.Clear("/a")
+	if nilerrors.Len() != 0 || nilerrors.Errors() != nil {
+		t.Error("nil CrawlErrors should be empty")
+	}
+
+	crawlerrors := NewCrawlErrors()
+	crawlerrors.Add("/a", "readdir", &os.PathError{Op: "open", Path: "/a", Err: syscall.EACCES})
+	crawlerrors.Add("/a", "inotify_add_watch", syscall.ENOSPC)
+	crawlerrors.Add("/b", "readdir", errors.New("something else"))
+	crawlerrors.Add("/b", "readdir", errors.New("something else again"))
+	crawlerrors.Add("", "inotify", errors.New("queue overflow"))
+
+	if crawlerrors.Len() != 4 || crawlerrors.Total() != 5 {
+		t.Error("unexpected number of errors:", crawlerrors.Len(), crawlerrors.Total())
+	}
+
+	found := make(map[string]CrawlError)
+	for _, crawlerror := range crawlerrors.Errors() {
+		found[crawlerror.path+" "+crawlerror.op] = crawlerror
+	}
+
+	if crawlerror, ok := found["/a open"]; !ok || crawlerror.errno != syscall.EACCES || crawlerror.Reason() != "permission denied (EACCES)" {
+		t.Error("expected EACCES from open for /a:", found)
+	}
+	if crawlerror, ok := found["/a inotify_add_watch"]; !ok || crawlerror.errno != syscall.ENOSPC {
+		t.Error("expected ENOSPC from inotify_add_watch for /a:", found)
+	}
+	if crawlerror, ok := found["/b readdir"]; !ok || crawlerror.errno != 0 || crawlerror.err.Error() != "something else again" {
+		t.Error("expected the most recent readdir error for /b:", found)
+	}
+
+	crawlerrors.Clear("/a")
+	if crawlerrors.Len() != 2 || crawlerrors.Total() != 5 {
+		t.Error("unexpected number of errors after Clear:", crawlerrors.Len(), crawlerrors.Total())
+	}
+
+	log.Println("TestCrawlErrors finished")
+}
+
+func TestCrawlerErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// - permissions don't stop root from reading a directory, so we make the crawler fail by giving
+	// it a file to crawl instead
+	notadir := path.Join(dir, "notadir")
+	if err := ioutil.WriteFile(notadir, []byte("notadir"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mem := NewResultMemory()
+	config := Configuration{
+		cores:       runtime.NumCPU(),
+		directories: []string{notadir},
+		maxinotify:  1024,
+	}
+
+	crawlerrors := NewCrawlErrors()
+	startCrawler(testCrawler{mem: mem, config: config, crawlerrors: crawlerrors}).stop()
+
+	recorded := crawlerrors.Errors()
+	if len(recorded) != 1 || recorded[0].path != notadir || recorded[0].errno != syscall.ENOTDIR {
+		t.Error("expected ENOTDIR for", notadir, "got", recorded)
+	}
+
+	log.Println("TestCrawlerErrors finished")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// - the columns of mem store the ids of entries instead of pointers, an id is half the size of a pointer
+// and the entries are only stored once, here
+type EntryId uint32
+
+const ENTRYTABLE_CHUNKSIZE int = 1 << 16
+
+// - refs counts how often an id is stored in the columns, it is only used while holding the mutex of
+// the table, the entries are read without it
+type entryChunk struct {
+	entries [ENTRYTABLE_CHUNKSIZE]atomic.Pointer[FileEntry]
+	refs    [ENTRYTABLE_CHUNKSIZE]int32
+}
+
+// - maps ids to entries, the entries are kept in chunks that never move, so that Get can be called while
+// ids are added without taking the mutex, ids of entries that are not stored in any column anymore are
+// used again
+// - id zero is never given out, it marks an entry that has no id
+// - every mem has its own table, so the entries of a mem that is dropped are dropped with it, an entry
+// can only be in the columns of one table at a time because it only has room for one id
+type EntryTable struct {
+	mutex  sync.Mutex
+	chunks atomic.Pointer[[]*entryChunk]
+	free   []EntryId
+	next   EntryId
+	len    int
+}
+
+func NewEntryTable() *EntryTable {
+	table := &EntryTable{next: 1}
+	table.chunks.Store(new([]*entryChunk))
+	return table
+}
+
+func (table *EntryTable) slot(id EntryId) (*entryChunk, int) {
+	chunks := *table.chunks.Load()
+	return chunks[int(id)/ENTRYTABLE_CHUNKSIZE], int(id) % ENTRYTABLE_CHUNKSIZE
+}
+
+// - the ids of files for a column that is about to store them, entries get an id the first time they are
+// stored in a column, so that all columns store the same id for them, every call must be matched by
+// a call to Unref once the column does not store the ids anymore
+func (table *EntryTable) Ref(files []*FileEntry) []EntryId {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	ids := make([]EntryId, len(files))
+	for i, entry := range files {
+		id := EntryId(entry.id.Load())
+		if id == 0 {
+			if len(table.free) > 0 {
+				id = table.free[len(table.free)-1]
+				table.free = table.free[:len(table.free)-1]
+			} else {
+				id = table.next
+				table.next += 1
+
+				chunks := *table.chunks.Load()
+				if int(id)/ENTRYTABLE_CHUNKSIZE >= len(chunks) {
+					grown := append(chunks[:len(chunks):len(chunks)], new(entryChunk))
+					table.chunks.Store(&grown)
+				}
+			}
+
+			chunk, j := table.slot(id)
+			chunk.entries[j].Store(entry)
+			entry.id.Store(uint32(id))
+			table.len += 1
+		}
+
+		chunk, j := table.slot(id)
+		chunk.refs[j] += 1
+		ids[i] = id
+	}
+
+	return ids
+}
+
+// - called by the columns for the ids they removed, once an id is not stored in any column anymore
+// its entry is dropped and the id is given to other entries afterwards
+func (table *EntryTable) Unref(ids []EntryId) {
+	if len(ids) == 0 {
+		return
+	}
+
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	for _, id := range ids {
+		chunk, i := table.slot(id)
+		chunk.refs[i] -= 1
+		if chunk.refs[i] > 0 {
+			continue
+		}
+
+		chunk.entries[i].Swap(nil).id.Store(0)
+		table.free = append(table.free, id)
+		table.len -= 1
+	}
+}
+
+func (table *EntryTable) Get(id EntryId) *FileEntry {
+	chunk, i := table.slot(id)
+	return chunk.entries[i].Load()
+}
+
+// - the order of sortcolumn for ids, the chunks are only loaded once, all ids that are compared were given
+// out before the function was made
+func (table *EntryTable) Less(sortcolumn SortColumn) func(a, b EntryId) bool {
+	less := orderings[sortcolumn].less
+	chunks := *table.chunks.Load()
+	return func(a, b EntryId) bool {
+		return less(chunks[int(a)/ENTRYTABLE_CHUNKSIZE].entries[int(a)%ENTRYTABLE_CHUNKSIZE].Load(), chunks[int(b)/ENTRYTABLE_CHUNKSIZE].entries[int(b)%ENTRYTABLE_CHUNKSIZE].Load())
+	}
+}
+
+func (table *EntryTable) Len() int {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	return table.len
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"testing"
+)
+
+func TestEntryTable(t *testing.T) {
+	table := NewEntryTable()
+
+	// - more entries than fit into one chunk, every entry gets its own id once, even when several
+	// columns ask for it at the same time
+	files := generateFileEntries(ENTRYTABLE_CHUNKSIZE+10, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, entry := range files {
+				table.Ref([]*FileEntry{entry})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if table.Len() != len(files) {
+		t.Fatal("expected", len(files), "entries in table, got", table.Len())
+	}
+	seen := make(map[EntryId]bool)
+	for _, entry := range files {
+		id := EntryId(entry.id.Load())
+		if id == 0 || seen[id] || table.Get(id) != entry {
+			t.Fatal("entry", entry.name, "has a wrong or duplicate id", id)
+		}
+		seen[id] = true
+	}
+
+	// - an id stays in the table until every column that stored it gave it back, and is then given to
+	// new entries again
+	released := EntryId(files[0].id.Load())
+	for i := 0; i < 3; i++ {
+		table.Unref([]EntryId{released})
+	}
+	if files[0].id.Load() == 0 || table.Get(released) != files[0] {
+		t.Error("entry was dropped while a column still stores it")
+	}
+	table.Unref([]EntryId{released})
+	if files[0].id.Load() != 0 || table.Get(released) != nil || table.Len() != len(files)-1 {
+		t.Error("released entry is still in the table")
+	}
+	entry := &FileEntry{direntry: &DirEntry{path: "/x"}, name: "new"}
+	if ids := table.Ref([]*FileEntry{entry}); ids[0] != released || table.Get(ids[0]) != entry {
+		t.Error("expected released id", released, "to be used again, got", ids[0])
+	}
+
+	log.Println("TestEntryTable finished")
+}
+
+func TestEntryTableColumns(t *testing.T) {
+	mem := NewResultMemory()
+	files := generateFileEntries(100, 2)
+
+	mergeFiles(mem, files)
+	for _, entry := range files {
+		if id := EntryId(entry.id.Load()); id == 0 || mem.table.Get(id) != entry {
+			t.Fatal("merged entry", entry.name, "has no id")
+		}
+	}
+
+	// - an entry that is only removed from some of the columns keeps its id for the others
+	for _, sortcolumn := range []SortColumn{SORT_BY_NAME, SORT_BY_DIR} {
+		mem.Column(sortcolumn).Remove(sortcolumn, files[:1])
+	}
+	if id := EntryId(files[0].id.Load()); id == 0 || mem.table.Get(id) != files[0] {
+		t.Fatal("entry that is still in some columns lost its id")
+	}
+	for _, entry := range takeAll(mem.Column(SORT_BY_SIZE), SORT_BY_SIZE, DEFAULT_DIRECTION, nil, len(files)) {
+		if entry == nil {
+			t.Fatal("column returned an entry whose id was released")
+		}
+	}
+	for _, sortcolumn := range []SortColumn{SORT_BY_NAME, SORT_BY_DIR} {
+		mem.Column(sortcolumn).Merge(sortcolumn, files[:1])
+	}
+
+	// - an entry that was merged twice is still stored once after it was removed once
+	mergeFiles(mem, files[1:2])
+	removeFiles(mem, files[1:2])
+	if id := EntryId(files[1].id.Load()); id == 0 || mem.table.Get(id) != files[1] {
+		t.Fatal("entry that was merged twice lost its id after it was removed once")
+	}
+
+	removeFiles(mem, files)
+	for _, entry := range files {
+		if entry.id.Load() != 0 {
+			t.Fatal("removed entry", entry.name, "still has an id")
+		}
+	}
+	if mem.Column(SORT_BY_NAME).NumFiles() != 0 || mem.table.Len() != 0 {
+		t.Error("expected no entries after removing all of them, got", mem.Column(SORT_BY_NAME).NumFiles(), mem.table.Len())
+	}
+
+	log.Println("TestEntryTableColumns finished")
+}
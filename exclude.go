@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// - a single line of a .gitignore file or an entry of Configuration.exclude, patterns without a
+// slash match the name of a file or directory at any depth, patterns with a slash are anchored at
+// base, a trailing slash means only directories match and a leading ! re-includes what an earlier
+// pattern excluded
+type ExcludePattern struct {
+	base     string
+	segments []string
+	anchored bool
+	dironly  bool
+	negate   bool
+}
+
+func NewExcludePattern(base string, line string) (ExcludePattern, bool) {
+	pattern := ExcludePattern{base: base}
+
+	line = strings.TrimRight(line, " \t\r")
+	if len(line) == 0 || strings.HasPrefix(line, "#") {
+		return pattern, false
+	}
+
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		pattern.dironly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if strings.Contains(line, "/") {
+		pattern.anchored = true
+		line = strings.TrimLeft(line, "/")
+	}
+
+	if len(line) == 0 {
+		return pattern, false
+	}
+
+	pattern.segments = strings.Split(line, "/")
+	return pattern, true
+}
+
+func (pattern ExcludePattern) Match(fullpath string, isdir bool) bool {
+	if pattern.dironly && !isdir {
+		return false
+	}
+
+	if !pattern.anchored {
+		matched, _ := path.Match(pattern.segments[0], path.Base(fullpath))
+		return matched
+	}
+
+	rel := fullpath
+	if pattern.base != "" && pattern.base != "/" {
+		if !strings.HasPrefix(fullpath, pattern.base+"/") {
+			return false
+		}
+		rel = fullpath[len(pattern.base):]
+	}
+
+	return matchSegments(pattern.segments, strings.Split(strings.TrimLeft(rel, "/"), "/"))
+}
+
+// - ** matches zero or more whole segments, everything else is matched segment by segment with path.Match
+func matchSegments(patterns []string, segments []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(patterns[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		if matched, _ := path.Match(patterns[0], segments[0]); !matched {
+			return false
+		}
+
+		patterns = patterns[1:]
+		segments = segments[1:]
+	}
+
+	return len(segments) == 0
+}
+
+type Exclusions struct {
+	patterns   []ExcludePattern
+	gitignore  bool
+	gitignores sync.Map
+}
+
+func NewExclusions(exclude []string, gitignore bool) *Exclusions {
+	exclusions := &Exclusions{gitignore: gitignore}
+
+	for _, line := range exclude {
+		if pattern, ok := NewExcludePattern("", line); ok {
+			exclusions.patterns = append(exclusions.patterns, pattern)
+		}
+	}
+
+	return exclusions
+}
+
+// - reads the .gitignore in dir, or forgets the patterns we had for dir if it has none anymore
+func (exclusions *Exclusions) Load(dir string, hasgitignore bool) {
+	if exclusions == nil || !exclusions.gitignore {
+		return
+	}
+
+	if !hasgitignore {
+		exclusions.gitignores.Delete(dir)
+		return
+	}
+
+	file, err := os.Open(path.Join(dir, ".gitignore"))
+	if err != nil {
+		exclusions.gitignores.Delete(dir)
+		return
+	}
+	defer file.Close()
+
+	var patterns []ExcludePattern
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if pattern, ok := NewExcludePattern(dir, scanner.Text()); ok {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	exclusions.gitignores.Store(dir, patterns)
+}
+
+// - all patterns that apply to the entries of dir, the configured ones first and then those of the
+// .gitignore files from the top down to dir, so that deeper patterns can override earlier ones
+func (exclusions *Exclusions) Rules(dir string) []ExcludePattern {
+	if exclusions == nil {
+		return nil
+	}
+
+	if !exclusions.gitignore {
+		return exclusions.patterns
+	}
+
+	var gitignores [][]ExcludePattern
+	for d := dir; ; d = path.Dir(d) {
+		if patterns, ok := exclusions.gitignores.Load(d); ok {
+			gitignores = append(gitignores, patterns.([]ExcludePattern))
+		}
+
+		if d == "/" || d == "." {
+			break
+		}
+	}
+
+	rules := make([]ExcludePattern, len(exclusions.patterns))
+	copy(rules, exclusions.patterns)
+	for i := len(gitignores) - 1; i >= 0; i-- {
+		rules = append(rules, gitignores[i]...)
+	}
+
+	return rules
+}
+
+func excluded(rules []ExcludePattern, fullpath string, isdir bool) bool {
+	result := false
+	for _, pattern := range rules {
+		if pattern.Match(fullpath, isdir) {
+			result = !pattern.negate
+		}
+	}
+	return result
+}
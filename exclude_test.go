@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+
+	"testing"
+)
+
+func TestExcludePattern(t *testing.T) {
+	tests := []struct {
+		base     string
+		pattern  string
+		fullpath string
+		isdir    bool
+		match    bool
+	}{
+		{"", "node_modules", "/home/user/project/node_modules", true, true},
+		{"", "node_modules", "/home/user/project/node_modules", false, true},
+		{"", "node_modules/", "/home/user/project/node_modules", false, false},
+		{"", ".git/", "/home/user/project/.git", true, true},
+		{"", "*.o", "/home/user/project/main.o", false, true},
+		{"", "*.o", "/home/user/project/main.go", false, false},
+		{"", "/home/*/.cache", "/home/user/.cache", true, true},
+		{"", "/home/*/.cache", "/home/user/project/.cache", true, false},
+		{"", "**/steamapps", "/mnt/games/SteamLibrary/steamapps", true, true},
+		{"", "/mnt/**/common", "/mnt/games/steamapps/common", true, true},
+		{"", "/mnt/**/common", "/home/games/steamapps/common", true, false},
+		{"/home/user/project", "/build", "/home/user/project/build", true, true},
+		{"/home/user/project", "/build", "/home/user/project/src/build", true, false},
+		{"/home/user/project", "build", "/home/user/project/src/build", true, true},
+		{"/home/user/project", "doc/*.html", "/home/user/project/doc/index.html", false, true},
+		{"/home/user/project", "doc/*.html", "/home/user/project/doc/api/index.html", false, false},
+		{"/home/user/project", "doc/**", "/home/user/project/doc/api/index.html", false, true},
+		{"/home/user/project", "/build", "/home/user/other/build", true, false},
+	}
+
+	for _, test := range tests {
+		pattern, ok := NewExcludePattern(test.base, test.pattern)
+		if !ok {
+			t.Error("could not parse pattern", test.pattern)
+			continue
+		}
+
+		if pattern.Match(test.fullpath, test.isdir) != test.match {
+			t.Error("pattern", test.pattern, "in", test.base, "matching", test.fullpath, "should be", test.match)
+		}
+	}
+
+	for _, line := range []string{"", "   ", "# comment", "/", "!"} {
+		if _, ok := NewExcludePattern("", line); ok {
+			t.Error("line", line, "should not be a pattern")
+		}
+	}
+
+	rules := NewExclusions([]string{"*.log", "!important.log"}, false).Rules("/var/log")
+	if !excluded(rules, "/var/log/syslog.log", false) {
+		t.Error("syslog.log should be excluded")
+	}
+	if excluded(rules, "/var/log/important.log", false) {
+		t.Error("important.log should be re-included")
+	}
+
+	log.Println("TestExcludePattern finished")
+}
+
+func TestReadDirExclusions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, subdir := range []string{".git", "node_modules", "src", "src/build"} {
+		if err := os.Mkdir(path.Join(dir, subdir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		".gitignore":     "*.o\n/src/build/\n",
+		"main.c":         "",
+		"main.o":         "",
+		"src/util.c":     "",
+		"src/util.o":     "",
+		"src/.gitignore": "!util.o\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(path.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := func(fileentries []*FileEntry) map[string]bool {
+		result := make(map[string]bool)
+		for _, entry := range fileentries {
+			result[entry.name] = true
+		}
+		return result
+	}
+
+	exclusions := NewExclusions([]string{".git/", "node_modules/"}, false)
+	_, fileentries, subdirs, err := readDir(exclusions, nil, nil, &DirEntry{path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subdirs) != 1 || subdirs[0] != path.Join(dir, "src") {
+		t.Error("expected only src as subdirectory, got", subdirs)
+	}
+	if !names(fileentries)["main.o"] {
+		t.Error("main.o should not be excluded without gitignore")
+	}
+
+	exclusions = NewExclusions([]string{".git/", "node_modules/"}, true)
+	_, fileentries, _, err = readDir(exclusions, nil, nil, &DirEntry{path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := names(fileentries); found["main.o"] || !found["main.c"] || !found[".gitignore"] {
+		t.Error("unexpected files with gitignore:", found)
+	}
+
+	_, fileentries, subdirs, err = readDir(exclusions, nil, nil, &DirEntry{path: path.Join(dir, "src")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subdirs) != 0 {
+		t.Error("src/build should be excluded by the top .gitignore, got", subdirs)
+	}
+	if found := names(fileentries); !found["util.o"] || !found["util.c"] {
+		t.Error("util.o should be re-included by src/.gitignore:", found)
+	}
+
+	log.Println("TestReadDirExclusions finished")
+}
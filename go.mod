@@ -6,6 +6,5 @@ require (
 	github.com/fsnotify/fsnotify v1.8.0
 	github.com/gijsbers/go-pcre v0.0.0-20161214203829-a84f3096ab3c
 	github.com/gotk3/gotk3 v0.6.5-0.20240618185848-ff349ae13f56
+	golang.org/x/sys v0.13.0
 )
-
-require golang.org/x/sys v0.13.0 // indirect
@@ -1,18 +1,21 @@
 package main
 
 import (
-	//"fmt"
+	"context"
+	"fmt"
 	"log"
 	"os"
 	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 
-	"sort"
 	"time"
 
 	glib "github.com/gotk3/gotk3/glib"
 	gtk "github.com/gotk3/gotk3/gtk"
+	unix "golang.org/x/sys/unix"
 )
 
 const (
@@ -21,13 +24,71 @@ const (
 	DEFAULT_SORT       SortColumn   = SORT_BY_MODTIME
 )
 
-func createColumn(title string, id SortColumn) *gtk.TreeViewColumn {
+// - columns with details about files that can not be sorted by, they are hidden until they are enabled
+// in the columns menu, in the list store they come after the columns of all orderings
+type DetailColumn struct {
+	title  string
+	action string
+	width  int
+	text   func(entry *FileEntry) string
+}
+
+var detailColumns = []DetailColumn{
+	{"Type", "column-type", 100, func(entry *FileEntry) string { return entry.FileType().String() }},
+	{"Mode", "column-mode", 110, func(entry *FileEntry) string { return entry.mode.String() }},
+	{"Owner", "column-owner", 100, func(entry *FileEntry) string { return lookupUserName(entry.uid) }},
+	{"Group", "column-group", 100, func(entry *FileEntry) string { return lookupGroupName(entry.gid) }},
+	{"Links", "column-links", 60, func(entry *FileEntry) string { return strconv.FormatUint(entry.nlink, 10) }},
+	{"Inode", "column-inode", 120, func(entry *FileEntry) string { return strconv.FormatUint(entry.inode, 10) }},
+	{"Device", "column-device", 80, func(entry *FileEntry) string {
+		return fmt.Sprintf("%d:%d", unix.Major(entry.device), unix.Minor(entry.device))
+	}},
+	{"Via link", "column-linked", 60, func(entry *FileEntry) string {
+		if entry.linked {
+			return "yes"
+		}
+		return ""
+	}},
+	{"Aliases", "column-aliases", 200, func(entry *FileEntry) string {
+		return strings.Join(entry.AliasGroup().Paths(entry), ", ")
+	}},
+}
+
+func createDetailColumn(detail DetailColumn, id int) *gtk.TreeViewColumn {
 	cellrenderer, err := gtk.CellRendererTextNew()
 	if err != nil {
 		log.Fatal("Unable to create text cell renderer:", err)
 	}
 
-	column, err := gtk.TreeViewColumnNewWithAttribute(title, cellrenderer, "text", int(id))
+	column, err := gtk.TreeViewColumnNewWithAttribute(detail.title, cellrenderer, "text", id)
+	if err != nil {
+		log.Fatal("Unable to create cell column:", err)
+	}
+
+	column.SetSizing(gtk.TREE_VIEW_COLUMN_FIXED)
+	column.SetResizable(true)
+	column.SetReorderable(true)
+	column.SetFixedWidth(detail.width)
+	column.SetMinWidth(40)
+	column.SetVisible(false)
+
+	return column
+}
+
+// - the list store column of the detail column with index i
+func detailColumnId(i int) int {
+	return len(orderings) + i
+}
+
+func createColumn(id SortColumn) *gtk.TreeViewColumn {
+	ordering := orderings[id]
+
+	cellrenderer, err := gtk.CellRendererTextNew()
+	if err != nil {
+		log.Fatal("Unable to create text cell renderer:", err)
+	}
+
+	column, err := gtk.TreeViewColumnNewWithAttribute(ordering.title, cellrenderer, "text", int(id))
 	if err != nil {
 		log.Fatal("Unable to create cell column:", err)
 	}
@@ -42,20 +103,8 @@ func createColumn(title string, id SortColumn) *gtk.TreeViewColumn {
 		column.SetSortOrder(DEFAULT_DIRECTION)
 	}
 
-	switch id {
-	case SORT_BY_NAME:
-		column.SetFixedWidth(500)
-		column.SetMinWidth(60)
-	case SORT_BY_DIR:
-		column.SetFixedWidth(800)
-		column.SetMinWidth(60)
-	case SORT_BY_MODTIME:
-		column.SetFixedWidth(200)
-		column.SetMinWidth(60)
-	case SORT_BY_SIZE:
-		column.SetFixedWidth(120)
-		column.SetMinWidth(60)
-	}
+	column.SetFixedWidth(ordering.width)
+	column.SetMinWidth(40)
 
 	return column
 }
@@ -66,13 +115,19 @@ func setupTreeView() (*gtk.TreeView, *gtk.ListStore) {
 		log.Fatal("Unable to create tree view:", err)
 	}
 
-	treeview.AppendColumn(createColumn("Name", SORT_BY_NAME))
-	treeview.AppendColumn(createColumn("Dir", SORT_BY_DIR))
-	treeview.AppendColumn(createColumn("Size", SORT_BY_SIZE))
-	treeview.AppendColumn(createColumn("Modification Time", SORT_BY_MODTIME))
+	for i := range orderings {
+		treeview.AppendColumn(createColumn(SortColumn(i)))
+	}
+	for i, detail := range detailColumns {
+		treeview.AppendColumn(createDetailColumn(detail, detailColumnId(i)))
+	}
 
 	// Creating a list store. This is what holds the data that will be shown on our tree view.
-	liststore, err := gtk.ListStoreNew(glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING)
+	types := make([]glib.Type, detailColumnId(len(detailColumns)))
+	for i := range types {
+		types[i] = glib.TYPE_STRING
+	}
+	liststore, err := gtk.ListStoreNew(types...)
 	if err != nil {
 		log.Fatal("Unable to create list store:", err)
 	}
@@ -85,7 +140,7 @@ func setupTreeView() (*gtk.TreeView, *gtk.ListStore) {
 	return treeview, liststore
 }
 
-func setupWindow(application *gtk.Application, treeview *gtk.TreeView, title string) (*gtk.ApplicationWindow, *gtk.ScrolledWindow, *gtk.SearchEntry) {
+func setupWindow(application *gtk.Application, treeview *gtk.TreeView, title string) (*gtk.ApplicationWindow, *gtk.ScrolledWindow, *gtk.SearchEntry, *gtk.ComboBoxText, *gtk.Statusbar) {
 
 	header, err := gtk.HeaderBarNew()
 	if err != nil {
@@ -103,6 +158,14 @@ func setupWindow(application *gtk.Application, treeview *gtk.TreeView, title str
 		log.Fatal("Could not create menu (nil)")
 	}
 	menu.Append("Crawl", "app.crawl")
+	menu.Append("Errors", "app.errors")
+	menu.Append("History", "app.history")
+
+	columnsmenu := glib.MenuNew()
+	for _, detail := range detailColumns {
+		columnsmenu.Append(detail.title, "app."+detail.action)
+	}
+	menu.AppendSubmenu("Columns", &columnsmenu.MenuModel)
 	menu.Append("Quit", "app.quit")
 
 	mbtn.SetMenuModel(&menu.MenuModel)
@@ -119,6 +182,17 @@ func setupWindow(application *gtk.Application, treeview *gtk.TreeView, title str
 
 	header.SetCustomTitle(searchentry)
 
+	// - the order of the items must match the values of EntryFilter, the active item is sent as filter
+	filtercombo, err := gtk.ComboBoxTextNew()
+	if err != nil {
+		log.Fatal("Could not create combo box:", err)
+	}
+	filtercombo.AppendText("Files and directories")
+	filtercombo.AppendText("Files only")
+	filtercombo.AppendText("Directories only")
+	filtercombo.SetActive(int(FILTER_ALL))
+	header.PackEnd(filtercombo)
+
 	appwin, err := gtk.ApplicationWindowNew(application)
 	if err != nil {
 		log.Fatal("Unable to create window:", err)
@@ -139,24 +213,194 @@ func setupWindow(application *gtk.Application, treeview *gtk.TreeView, title str
 		log.Fatal("unable to create scrolled window:", err)
 	}
 
+	statusbar, err := gtk.StatusbarNew()
+	if err != nil {
+		log.Fatal("unable to create status bar:", err)
+	}
+
 	appwin.Add(verticalbox)
 	scrollwin.Add(treeview)
 	verticalbox.PackStart(scrollwin, true, true, 5)
+	verticalbox.PackStart(statusbar, false, false, 0)
 	appwin.ShowAll()
 
-	return appwin, scrollwin, searchentry
+	return appwin, scrollwin, searchentry, filtercombo, statusbar
 }
 
-func addEntry(liststore *gtk.ListStore, entry *FileEntry) gtk.TreeIter {
-	sizestring := SizeThreshold(entry.size).String()
+// - lists the directories and files that could not be read or watched, with the errno so that one can
+// tell permission problems apart from running out of inotify watches
+func showErrorsDialog(parent *gtk.ApplicationWindow, crawlerrors []CrawlError) {
+	dialog, err := gtk.DialogNewWithButtons("Crawl Errors", parent, gtk.DIALOG_MODAL|gtk.DIALOG_DESTROY_WITH_PARENT,
+		[]interface{}{"Close", gtk.RESPONSE_CLOSE})
+	if err != nil {
+		log.Println("Unable to create dialog:", err)
+		return
+	}
+	defer dialog.Destroy()
+	dialog.SetDefaultSize(1000, 600)
+
+	treeview, err := gtk.TreeViewNew()
+	if err != nil {
+		log.Fatal("Unable to create tree view:", err)
+	}
+
+	for i, title := range []string{"Path", "Operation", "Error", "Time"} {
+		cellrenderer, err := gtk.CellRendererTextNew()
+		if err != nil {
+			log.Fatal("Unable to create text cell renderer:", err)
+		}
+
+		column, err := gtk.TreeViewColumnNewWithAttribute(title, cellrenderer, "text", i)
+		if err != nil {
+			log.Fatal("Unable to create cell column:", err)
+		}
+		column.SetResizable(true)
+		treeview.AppendColumn(column)
+	}
+
+	liststore, err := gtk.ListStoreNew(glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING)
+	if err != nil {
+		log.Fatal("Unable to create list store:", err)
+	}
+
+	for _, crawlerror := range crawlerrors {
+		var iter gtk.TreeIter
+		err := liststore.InsertWithValues(&iter, -1, []int{0, 1, 2, 3},
+			[]interface{}{crawlerror.path, crawlerror.op, crawlerror.Reason(), crawlerror.time.Format("2006-01-02 15:04:05")})
+		if err != nil {
+			log.Fatal("Unable to add row:", err)
+		}
+	}
+	treeview.SetModel(liststore)
+
+	scrollwin, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		log.Fatal("unable to create scrolled window:", err)
+	}
+	scrollwin.Add(treeview)
+
+	contentarea, err := dialog.GetContentArea()
+	if err != nil {
+		log.Fatal("Unable to get dialog content area:", err)
+	}
+	contentarea.PackStart(scrollwin, true, true, 5)
+
+	dialog.ShowAll()
+	dialog.Run()
+}
+
+// - lists what the journal recorded below a directory, most recent first, a renamed entry shows where it
+// was before in the last column
+func showHistoryDialog(parent *gtk.ApplicationWindow, dir string, changes []Change) {
+	title := "History"
+	if dir != "" {
+		title = "History of " + dir
+	}
+	dialog, err := gtk.DialogNewWithButtons(title, parent, gtk.DIALOG_MODAL|gtk.DIALOG_DESTROY_WITH_PARENT,
+		[]interface{}{"Close", gtk.RESPONSE_CLOSE})
+	if err != nil {
+		log.Println("Unable to create dialog:", err)
+		return
+	}
+	defer dialog.Destroy()
+	dialog.SetDefaultSize(1000, 600)
+
+	treeview, err := gtk.TreeViewNew()
+	if err != nil {
+		log.Fatal("Unable to create tree view:", err)
+	}
+
+	for i, title := range []string{"Time", "Change", "Path", "Old path"} {
+		cellrenderer, err := gtk.CellRendererTextNew()
+		if err != nil {
+			log.Fatal("Unable to create text cell renderer:", err)
+		}
+
+		column, err := gtk.TreeViewColumnNewWithAttribute(title, cellrenderer, "text", i)
+		if err != nil {
+			log.Fatal("Unable to create cell column:", err)
+		}
+		column.SetResizable(true)
+		treeview.AppendColumn(column)
+	}
+
+	liststore, err := gtk.ListStoreNew(glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING)
+	if err != nil {
+		log.Fatal("Unable to create list store:", err)
+	}
+
+	for _, change := range changes {
+		changepath := change.path
+		if change.isdir {
+			changepath += "/"
+		}
+
+		var iter gtk.TreeIter
+		err := liststore.InsertWithValues(&iter, -1, []int{0, 1, 2, 3},
+			[]interface{}{change.time.Format("2006-01-02 15:04:05"), change.kind.String(), changepath, change.oldpath})
+		if err != nil {
+			log.Fatal("Unable to add row:", err)
+		}
+	}
+	treeview.SetModel(liststore)
+
+	scrollwin, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		log.Fatal("unable to create scrolled window:", err)
+	}
+	scrollwin.Add(treeview)
+
+	contentarea, err := dialog.GetContentArea()
+	if err != nil {
+		log.Fatal("Unable to get dialog content area:", err)
+	}
+	contentarea.PackStart(scrollwin, true, true, 5)
+
+	dialog.ShowAll()
+	dialog.Run()
+}
+
+// - the directory of the selected row, or an empty string when nothing is selected
+func selectedDir(treeview *gtk.TreeView, liststore *gtk.ListStore) string {
+	selection, err := treeview.GetSelection()
+	if err != nil {
+		return ""
+	}
+
+	_, iter, ok := selection.GetSelected()
+	if !ok {
+		return ""
+	}
+
+	value, err := liststore.GetValue(iter, int(SORT_BY_DIR))
+	if err != nil {
+		return ""
+	}
+
+	dir, _ := value.GetString()
+	return dir
+}
+
+func entryValues(entry *FileEntry) ([]int, []interface{}) {
+	var columns []int
+	var values []interface{}
+	for i, ordering := range orderings {
+		columns = append(columns, i)
+		values = append(values, ordering.text(entry))
+	}
+	for i, detail := range detailColumns {
+		columns = append(columns, detailColumnId(i))
+		values = append(values, detail.text(entry))
+	}
+
+	return columns, values
+}
 
-	modtime := entry.modtime
-	modtimestring := modtime.Format("2006-01-02 15:04:05")
+func addEntry(liststore *gtk.ListStore, entry *FileEntry) gtk.TreeIter {
+	columns, values := entryValues(entry)
 
 	var iter gtk.TreeIter
-	err := liststore.InsertWithValues(&iter, -1,
-		[]int{int(SORT_BY_NAME), int(SORT_BY_DIR), int(SORT_BY_SIZE), int(SORT_BY_MODTIME)},
-		[]interface{}{entry.name, entry.dir, sizestring, modtimestring})
+	err := liststore.InsertWithValues(&iter, -1, columns, values)
 
 	if err != nil {
 		log.Fatal("Unable to add row:", err)
@@ -166,14 +410,9 @@ func addEntry(liststore *gtk.ListStore, entry *FileEntry) gtk.TreeIter {
 }
 
 func updateEntry(iter *gtk.TreeIter, liststore *gtk.ListStore, entry *FileEntry) {
-	sizestring := SizeThreshold(entry.size).String()
-
-	modtime := entry.modtime
-	modtimestring := modtime.Format("2006-01-02 15:04:05")
+	columns, values := entryValues(entry)
 
-	err := liststore.Set(iter,
-		[]int{int(SORT_BY_NAME), int(SORT_BY_DIR), int(SORT_BY_SIZE), int(SORT_BY_MODTIME)},
-		[]interface{}{entry.name, entry.dir, sizestring, modtimestring})
+	err := liststore.Set(iter, columns, values)
 
 	if err != nil {
 		log.Fatal("Unable to update row:", err)
@@ -193,29 +432,7 @@ func instantSort(list *ViewList, oldsort SortColumn, olddirection gtk.SortType,
 			list.mutex.Lock()
 
 			if oldsort != newsort {
-				var directories []string
-				direntries := make(map[string][]*FileEntry)
-				for _, entry := range list.entries {
-					entries, ok := direntries[entry.dir]
-					direntries[entry.dir] = append(entries, entry)
-					if !ok {
-						directories = append(directories, entry.dir)
-					}
-				}
-				list.entries = list.entries[:0]
-				sort.Stable(sort.Reverse(sort.StringSlice(directories)))
-				for _, dir := range directories {
-					entries, _ := direntries[dir]
-
-					sort.Stable(SortedByName(entries))
-					switch newsort {
-					case SORT_BY_MODTIME:
-						sort.Stable(SortedByModTime(entries))
-					case SORT_BY_SIZE:
-						sort.Stable(SortedBySize(entries))
-					}
-					list.entries = sortMerge(newsort, list.entries, entries)
-				}
+				sortFileEntries(newsort, list.entries)
 			} else if olddirection != newdirection {
 				for i := len(list.entries)/2 - 1; i >= 0; i-- {
 					opp := len(list.entries) - 1 - i
@@ -243,7 +460,7 @@ func instantSort(list *ViewList, oldsort SortColumn, olddirection gtk.SortType,
 	return ret
 }
 
-func instantSearch(list *ViewList, query *regexp.Regexp) int {
+func instantSearch(list *ViewList, query *regexp.Regexp, filter EntryFilter) int {
 	ret := 0
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -256,7 +473,8 @@ func instantSearch(list *ViewList, query *regexp.Regexp) int {
 		iter, valid := list.store.GetIterFirst()
 		for iter != nil && valid == true {
 
-			if query == nil || query.MatchString(list.entries[i].name) || query.MatchString(list.entries[i].dir) {
+			entry := list.entries[i]
+			if filter.Accept(entry) && (query == nil || query.MatchString(entry.name) || query.MatchString(entry.Dir())) {
 				newentries = append(newentries, list.entries[i])
 			} else {
 				removeindices = append(removeindices, i)
@@ -381,18 +599,20 @@ type ViewControls struct {
 	more       chan struct{}
 	reset      chan struct{}
 	searchterm chan string
+	filter     chan EntryFilter
 }
 
 func Controller(mem ResultMemory, viewcontrols ViewControls, list *ViewList) {
 	currentsort := DEFAULT_SORT
 	currentdirection := DEFAULT_DIRECTION
 	var currentquery *regexp.Regexp
+	currentfilter := FILTER_ALL
 	lastpoll := time.Unix(0, 0)
 	inc := 1000
 	n := inc
 	abort := make(chan struct{})
 	maxproc := make(chan struct{}, 1)
-	matchcaches := MatchCaches{NewSimpleCache(), NewSimpleCache()}
+	matchcaches := MatchCaches{NewSimpleCache(), NewSimpleCache(), currentfilter}
 
 	for {
 		select {
@@ -420,11 +640,23 @@ func Controller(mem ResultMemory, viewcontrols ViewControls, list *ViewList) {
 				<-abort
 				abort = make(chan struct{})
 
-				listlength := instantSearch(list, currentquery)
+				listlength := instantSearch(list, currentquery, currentfilter)
 				for n > listlength && listlength > inc {
 					n -= inc
 				}
-				matchcaches = MatchCaches{NewSimpleCache(), NewSimpleCache()}
+				matchcaches = MatchCaches{NewSimpleCache(), NewSimpleCache(), currentfilter}
+				lastpoll = time.Unix(0, 0)
+			}
+		case filter := <-viewcontrols.filter:
+			if filter != currentfilter {
+				currentfilter = filter
+
+				close(abort)
+				<-abort
+				abort = make(chan struct{})
+
+				instantSearch(list, currentquery, currentfilter)
+				matchcaches = MatchCaches{NewSimpleCache(), NewSimpleCache(), currentfilter}
 				lastpoll = time.Unix(0, 0)
 			}
 		case newsort := <-viewcontrols.sort:
@@ -445,19 +677,9 @@ func Controller(mem ResultMemory, viewcontrols ViewControls, list *ViewList) {
 		case <-time.After(1000 * time.Millisecond):
 		}
 
-		var currentbucket Bucket
-		switch currentsort {
-		case SORT_BY_NAME:
-			currentbucket = mem.byname.(*Node)
-		case SORT_BY_DIR:
-			currentbucket = mem.bydir.(*Node)
-		case SORT_BY_SIZE:
-			currentbucket = mem.bysize.(*Node)
-		case SORT_BY_MODTIME:
-			currentbucket = mem.bymodtime.(*Node)
-		}
+		currentbucket := mem.Column(currentsort).(*Node)
 
-		if currentbucket.Node().lastchange.After(lastpoll) {
+		if currentbucket.LastChange().After(lastpoll) {
 			if len(maxproc) == 0 {
 				maxproc <- struct{}{}
 				lastpoll = time.Now()
@@ -499,10 +721,31 @@ func createColumnSortToggle(treeview *gtk.TreeView, clickedcolumn int, viewsortc
 	}
 }
 
+func createColumnVisibilityToggle(column *gtk.TreeViewColumn, name string) *glib.SimpleAction {
+	action := glib.SimpleActionNewStateful(name, nil, glib.VariantFromBoolean(column.GetVisible()))
+	action.Connect("activate", func() {
+		visible := !action.GetState().GetBoolean()
+		action.SetState(glib.VariantFromBoolean(visible))
+		column.SetVisible(visible)
+	})
+	return action
+}
+
 type Configuration struct {
-	cores       int
-	directories []string
-	maxinotify  int
+	cores          int
+	directories    []string
+	maxinotify     int
+	exclude        []string
+	gitignore      bool
+	index          string
+	journal        string
+	pollrate       int
+	recursivesize  bool
+	rootoptions    map[string]RootOptions
+	automount      map[string]RootOptions
+	followsymlinks bool
+	dedupe         bool
+	hooks          []Hook
 }
 
 func main() {
@@ -516,32 +759,42 @@ func main() {
 		log.Fatal("Could not create application:", err)
 	}
 
-	mem := ResultMemory{
-		NewNameBucket(),
-		NewDirBucket(),
-		NewModTimeBucket(),
-		NewSizeBucket(),
-	}
+	mem := NewResultMemory()
 	config := Configuration{
-		cores:       8, //runtime.NumCPU(),
-		directories: []string{os.Getenv("HOME")},
-		maxinotify:  100000,
+		cores:          8, //runtime.NumCPU(),
+		directories:    []string{os.Getenv("HOME")},
+		maxinotify:     0, // derived from /proc/sys/fs/inotify/max_user_watches
+		exclude:        []string{".git/", "node_modules/", ".cache/"},
+		gitignore:      false,
+		index:          IndexPath(),
+		journal:        JournalPath(), // created, modified, deleted and renamed entries, kept between runs
+		pollrate:       POLL_RATE,
+		recursivesize:  true,  // sizes of directories are the sum of all files below them
+		followsymlinks: false, // directories that are linked to are crawled below the path of the link
+		dedupe:         true,  // hardlinks and bind mounts are shown once, with the other paths as aliases
+		rootoptions: map[string]RootOptions{
+			os.Getenv("HOME"): {onefilesystem: false, skipfstypes: DEFAULT_SKIPFSTYPES, pollfstypes: DEFAULT_POLLFSTYPES},
+		},
+		// - drives mounted by udisks are crawled while they are mounted
+		automount: map[string]RootOptions{
+			"/media/" + os.Getenv("USER") + "/*":     {onefilesystem: true, skipfstypes: DEFAULT_SKIPFSTYPES, pollfstypes: DEFAULT_POLLFSTYPES},
+			"/run/media/" + os.Getenv("USER") + "/*": {onefilesystem: true, skipfstypes: DEFAULT_SKIPFSTYPES, pollfstypes: DEFAULT_POLLFSTYPES},
+		},
+		// - commands that run when matching files change, for example
+		// {name: "downloads", glob: os.Getenv("HOME") + "/Downloads/*", kinds: CHANGE_CREATED | CHANGE_RENAMED,
+		// 	command: []string{"notify-send", "Downloaded", "{name}"}}
+		hooks: nil,
 	}
 
-	//maxinotifybytes, readerr := ioutil.ReadFile("/proc/sys/fs/inotify/max_user_watches")
-	//if readerr == nil {
-	//	maxinotifystring := strings.TrimSpace(string(maxinotifybytes))
-	//
-	//	maxinotifyint64, converr := strconv.ParseUint(maxinotifystring, 10, 32)
-	//	if converr == nil {
-	//		config.maxinotify = int(maxinotifyint64) / 2
-	//	}
-	//}
+	journal := NewJournal(JOURNAL_CAPACITY, config.journal)
+	if err := journal.Load(); err != nil && !os.IsNotExist(err) {
+		log.Println("could not load journal:", err)
+	}
 
 	var wg sync.WaitGroup
 	application.Connect("activate", func() {
 		treeview, liststore := setupTreeView()
-		applicationwin, scrollwin, searchentry := setupWindow(application, treeview, "golocate")
+		applicationwin, scrollwin, searchentry, filtercombo, statusbar := setupWindow(application, treeview, "golocate")
 		searchentry.GrabFocus()
 
 		applicationwin.Connect("focus-in-event", func() {
@@ -557,6 +810,7 @@ func main() {
 			more:       make(chan struct{}),
 			reset:      make(chan struct{}),
 			searchterm: make(chan string),
+			filter:     make(chan EntryFilter),
 		}
 
 		viewlist := ViewList{
@@ -569,28 +823,51 @@ func main() {
 		go Controller(mem, viewcontrols, &viewlist)
 
 		crawlernewdirs := make(chan string)
-		crawlerfinish := make(chan struct{})
+		crawlerrescan := make(chan string)
+		crawlerprogress := make(chan CrawlProgress)
+		crawlerrors := NewCrawlErrors()
+		crawlerctx, crawlercancel := context.WithCancel(context.Background())
+		crawlerdone := make(chan struct{})
 		log.Println("starting Crawl on", config.cores, "cores")
 		wg.Add(1)
-		go Crawler(&wg, mem, config, crawlernewdirs, viewlist.query, crawlerfinish)
+		go func() {
+			Crawler(crawlerctx, &wg, mem, config, crawlernewdirs, crawlerrescan, viewlist.query, crawlerprogress, crawlerrors, journal)
+			close(crawlerdone)
+		}()
+
+		statuscontext := statusbar.GetContextId("crawler")
+		go func() {
+			for {
+				select {
+				case progress := <-crawlerprogress:
+					text := progress.String()
+					glib.IdleAdd(func() {
+						statusbar.Pop(statuscontext)
+						statusbar.Push(statuscontext, text)
+					})
+				case <-crawlerctx.Done():
+					return
+				}
+			}
+		}()
 
 		for i := 0; i < int(treeview.GetNColumns()); i++ {
 			column := treeview.GetColumn(i)
 			title := column.GetTitle()
-			switch title {
-			case "Name":
-				column.Connect("clicked", createColumnSortToggle(treeview, i, viewcontrols.sort, SORT_BY_NAME))
-			case "Dir":
-				column.Connect("clicked", createColumnSortToggle(treeview, i, viewcontrols.sort, SORT_BY_DIR))
-			case "Size":
-				column.Connect("clicked", createColumnSortToggle(treeview, i, viewcontrols.sort, SORT_BY_SIZE))
-			case "Modification Time":
-				column.Connect("clicked", createColumnSortToggle(treeview, i, viewcontrols.sort, SORT_BY_MODTIME))
-			default:
+			// - the columns of the orderings come first and in the order of their SortColumn
+			if i < len(orderings) {
+				column.Connect("clicked", createColumnSortToggle(treeview, i, viewcontrols.sort, SortColumn(i)))
+			} else {
 				column.Connect("clicked", func() {
 					log.Println("can not sort by", title)
 				})
 			}
+
+			for _, detail := range detailColumns {
+				if detail.title == title {
+					application.AddAction(createColumnVisibilityToggle(column, detail.action))
+				}
+			}
 		}
 
 		searchentry.Connect("search-changed", func(search *gtk.SearchEntry) {
@@ -603,6 +880,10 @@ func main() {
 			}
 		})
 
+		filtercombo.Connect("changed", func(combo *gtk.ComboBoxText) {
+			viewcontrols.filter <- EntryFilter(combo.GetActive())
+		})
+
 		lastupper := -1.0
 		adjustment := scrollwin.GetVAdjustment()
 		// adjustment.Connect("value-changed", func() {
@@ -631,13 +912,38 @@ func main() {
 
 		aCrawl := glib.SimpleActionNew("crawl", nil)
 		aCrawl.Connect("activate", func() {
+			// - with a selected row we only rescan the directory of that row, otherwise everything
+			dir := selectedDir(treeview, liststore)
+
+			// - the crawler may be busy, so we must not block the ui while waiting for it
+			go func() {
+				select {
+				case crawlerrescan <- dir:
+				case <-crawlerctx.Done():
+				}
+			}()
 		})
 		application.AddAction(aCrawl)
 
+		aErrors := glib.SimpleActionNew("errors", nil)
+		aErrors.Connect("activate", func() {
+			showErrorsDialog(applicationwin, crawlerrors.Errors())
+		})
+		application.AddAction(aErrors)
+
+		aHistory := glib.SimpleActionNew("history", nil)
+		aHistory.Connect("activate", func() {
+			// - like crawl, the history of the directory of the selected row, otherwise of everything
+			dir := selectedDir(treeview, liststore)
+			showHistoryDialog(applicationwin, dir, journal.Query(dir, CHANGE_ALL, time.Time{}))
+		})
+		application.AddAction(aHistory)
+
 		aQuit := glib.SimpleActionNew("quit", nil)
 		aQuit.Connect("activate", func() {
-			close(crawlerfinish)
-			<-crawlerfinish
+			// - the crawler saves the index before it returns, so we wait for it before quitting
+			crawlercancel()
+			<-crawlerdone
 			log.Println("Crawl terminated")
 			application.Quit()
 		})
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HOOKS_MAXPROC   int           = 4
+	HOOKS_QUEUE     int           = 1000
+	HOOKS_TIMEOUT   time.Duration = time.Minute
+	HOOKS_MAXOUTPUT int           = 64 * 1024
+	HOOKS_MAXRUNS   int           = 100
+)
+
+// - runs command when something that matches glob or regex changed in one of the ways in kinds, a glob
+// without a slash is matched against the name only, like "*.md", otherwise against the whole path
+// - the command is not run by a shell, {path}, {dir} and {name} are replaced in every argument, so a
+// hook that needs a shell has to run one itself, like []string{"sh", "-c", "make -C docs"}
+// - a command that writes files which match its own hook runs again for those, so it should write them
+// somewhere that does not match
+type Hook struct {
+	name    string
+	glob    string
+	regex   *regexp.Regexp
+	kinds   ChangeKind
+	command []string
+	timeout time.Duration
+}
+
+func (hook Hook) Match(change Change) bool {
+	if change.kind&hook.kinds == 0 {
+		return false
+	}
+
+	matched := hook.glob == "" && hook.regex == nil
+	if hook.glob != "" {
+		target := change.path
+		if !strings.Contains(hook.glob, "/") {
+			target = path.Base(change.path)
+		}
+		matched, _ = path.Match(hook.glob, target)
+	}
+	if hook.regex != nil && !matched {
+		matched = hook.regex.MatchString(change.path)
+	}
+	return matched
+}
+
+func (hook Hook) Expand(change Change) []string {
+	replacer := strings.NewReplacer("{path}", change.path, "{dir}", path.Dir(change.path), "{name}", path.Base(change.path))
+	args := make([]string, len(hook.command))
+	for i, arg := range hook.command {
+		args[i] = replacer.Replace(arg)
+	}
+	return args
+}
+
+// - one finished command, output is what it wrote to stdout and stderr, cut off after HOOKS_MAXOUTPUT
+type HookRun struct {
+	hook     string
+	args     []string
+	change   Change
+	start    time.Time
+	duration time.Duration
+	output   string
+	err      error
+}
+
+// - keeps the first HOOKS_MAXOUTPUT bytes a command writes and discards the rest, writes never fail so
+// that a command that writes a lot is not stopped by a broken pipe, exec calls Write from one goroutine
+// at a time because stdout and stderr are the same writer
+type hookOutput struct {
+	buf []byte
+}
+
+func (output *hookOutput) Write(p []byte) (int, error) {
+	if room := HOOKS_MAXOUTPUT - len(output.buf); room > 0 {
+		if len(p) > room {
+			output.buf = append(output.buf, p[:room]...)
+		} else {
+			output.buf = append(output.buf, p...)
+		}
+	}
+	return len(p), nil
+}
+
+type hookJob struct {
+	hook   Hook
+	args   []string
+	change Change
+}
+
+// - runs the hooks for the changes the crawler recorded in one batch of debounced events, commands are
+// run by a fixed number of workers, jobs that don't fit into the queue are dropped, all methods can be
+// called on a nil *Hooks
+type Hooks struct {
+	hooks []Hook
+	kinds ChangeKind
+	queue chan hookJob
+	mutex sync.Mutex
+	runs  []HookRun
+}
+
+// - returns nil when there are no hooks, so that nothing is started for them
+func NewHooks(hooks []Hook) *Hooks {
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	result := &Hooks{
+		hooks: hooks,
+		queue: make(chan hookJob, HOOKS_QUEUE),
+	}
+	for _, hook := range hooks {
+		result.kinds |= hook.kinds
+	}
+	return result
+}
+
+// - the kinds of changes that any hook is interested in
+func (hooks *Hooks) Kinds() ChangeKind {
+	if hooks == nil {
+		return 0
+	}
+	return hooks.kinds
+}
+
+// - the workers are started with spawn, so that whoever started them can wait until they returned, and
+// with them the commands they ran, which are killed once ctx is done
+func (hooks *Hooks) Start(ctx context.Context, maxproc int, spawn func(f func())) {
+	if hooks == nil {
+		return
+	}
+
+	for i := 0; i < maxproc; i++ {
+		spawn(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-hooks.queue:
+					hooks.run(ctx, job)
+				}
+			}
+		})
+	}
+}
+
+// - changes must be in the order in which they happened, a hook whose command expands to the same
+// arguments for several changes, because it does not use any placeholder, runs only once per batch
+func (hooks *Hooks) Run(changes []Change) {
+	if hooks == nil {
+		return
+	}
+
+	for _, hook := range hooks.hooks {
+		queued := make(map[string]bool)
+		for _, change := range changes {
+			if !hook.Match(change) {
+				continue
+			}
+
+			args := hook.Expand(change)
+			key := strings.Join(args, "\x00")
+			if queued[key] {
+				continue
+			}
+			queued[key] = true
+
+			select {
+			case hooks.queue <- hookJob{hook, args, change}:
+			default:
+				log.Println("hook", hook.name, "queue is full, dropped", args)
+			}
+		}
+	}
+}
+
+func (hooks *Hooks) run(ctx context.Context, job hookJob) {
+	timeout := job.hook.timeout
+	if timeout <= 0 {
+		timeout = HOOKS_TIMEOUT
+	}
+	runctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	output := &hookOutput{}
+	var err error
+	if len(job.args) == 0 {
+		err = errors.New("empty command")
+	} else {
+		cmd := exec.CommandContext(runctx, job.args[0], job.args[1:]...)
+		cmd.Stdout, cmd.Stderr = output, output
+		err = cmd.Run()
+	}
+	if runctx.Err() == context.DeadlineExceeded {
+		err = runctx.Err()
+	}
+
+	run := HookRun{job.hook.name, job.args, job.change, start, time.Since(start), string(output.buf), err}
+	if err != nil {
+		log.Println("hook", run.hook, "failed for", run.change.path, ":", err, strings.TrimSpace(run.output))
+	} else {
+		log.Println("hook", run.hook, "ran for", run.change.path, "in", run.duration)
+	}
+
+	hooks.mutex.Lock()
+	defer hooks.mutex.Unlock()
+	hooks.runs = append(hooks.runs, run)
+	if len(hooks.runs) > HOOKS_MAXRUNS {
+		hooks.runs = hooks.runs[len(hooks.runs)-HOOKS_MAXRUNS:]
+	}
+}
+
+// - the last HOOKS_MAXRUNS commands that finished, oldest first
+func (hooks *Hooks) Runs() []HookRun {
+	if hooks == nil {
+		return nil
+	}
+
+	hooks.mutex.Lock()
+	defer hooks.mutex.Unlock()
+	return append([]HookRun(nil), hooks.runs...)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"testing"
+)
+
+func TestHookMatch(t *testing.T) {
+	created := Change{kind: CHANGE_CREATED, path: "/home/user/docs/README.md"}
+	deleted := Change{kind: CHANGE_DELETED, path: "/home/user/docs/README.md"}
+
+	docs := Hook{glob: "*.md", kinds: CHANGE_CREATED | CHANGE_MODIFIED}
+	if !docs.Match(created) || docs.Match(deleted) {
+		t.Error("glob without slash should match the name for the given kinds only")
+	}
+
+	downloads := Hook{glob: "/home/user/Downloads/*", kinds: CHANGE_ALL}
+	if downloads.Match(created) || !downloads.Match(Change{kind: CHANGE_CREATED, path: "/home/user/Downloads/x.iso"}) {
+		t.Error("glob with slash should match the whole path")
+	}
+
+	regex := Hook{regex: regexp.MustCompile(`/docs/.*\.md$`), kinds: CHANGE_ALL}
+	if !regex.Match(deleted) || regex.Match(Change{kind: CHANGE_DELETED, path: "/home/user/src/README.md"}) {
+		t.Error("regex should match the whole path")
+	}
+
+	args := Hook{command: []string{"echo", "{path}", "{dir}", "{name}"}}.Expand(created)
+	if strings.Join(args, " ") != "echo /home/user/docs/README.md /home/user/docs README.md" {
+		t.Error("unexpected expansion of placeholders:", args)
+	}
+
+	log.Println("TestHookMatch finished")
+}
+
+func waitForRuns(hooks *Hooks, n int) []HookRun {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if runs := hooks.Runs(); len(runs) >= n {
+			return runs
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return hooks.Runs()
+}
+
+func TestHooks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var running sync.WaitGroup
+	spawn := func(f func()) {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			f()
+		}()
+	}
+
+	hooks := NewHooks([]Hook{
+		{name: "each", glob: "*.txt", kinds: CHANGE_CREATED, command: []string{"echo", "{name}"}},
+		{name: "once", glob: "*.txt", kinds: CHANGE_CREATED, command: []string{"echo", "rebuild"}},
+		{name: "slow", glob: "*.slow", kinds: CHANGE_ALL, command: []string{"sleep", "10"}, timeout: 100 * time.Millisecond},
+		{name: "loud", glob: "*.log", kinds: CHANGE_ALL, command: []string{"head", "-c", "1000000", "/dev/zero"}},
+	})
+	hooks.Start(ctx, 2, spawn)
+
+	hooks.Run([]Change{
+		{kind: CHANGE_CREATED, path: "/a/1.txt"},
+		{kind: CHANGE_CREATED, path: "/a/2.txt"},
+		{kind: CHANGE_DELETED, path: "/a/3.txt"},
+		{kind: CHANGE_MODIFIED, path: "/a/4.slow"},
+		{kind: CHANGE_MODIFIED, path: "/a/5.log"},
+	})
+
+	runs := waitForRuns(hooks, 5)
+	if len(runs) != 5 {
+		t.Fatal("expected two runs of each, one of once, one of slow and one of loud, got", len(runs))
+	}
+
+	outputs := make(map[string][]string)
+	for _, run := range runs {
+		outputs[run.hook] = append(outputs[run.hook], strings.TrimSpace(run.output))
+		if run.hook == "slow" && (run.err != context.DeadlineExceeded || run.duration > 5*time.Second) {
+			t.Error("slow hook was not stopped after its timeout:", run.err, run.duration)
+		}
+		if run.hook != "slow" && run.err != nil {
+			t.Error("hook", run.hook, "failed:", run.err)
+		}
+		if run.hook == "loud" && len(run.output) != HOOKS_MAXOUTPUT {
+			t.Error("output of loud hook was not cut off after", HOOKS_MAXOUTPUT, "bytes:", len(run.output))
+		}
+	}
+	if len(outputs["each"]) != 2 || len(outputs["once"]) != 1 || outputs["once"][0] != "rebuild" {
+		t.Error("unexpected output of hooks:", outputs)
+	}
+
+	var nilhooks *Hooks
+	nilhooks.Start(ctx, 2, spawn)
+	nilhooks.Run([]Change{{kind: CHANGE_CREATED, path: "/a/1.txt"}})
+	if NewHooks(nil) != nil || nilhooks.Kinds() != 0 || nilhooks.Runs() != nil {
+		t.Error("nil hooks should do nothing")
+	}
+
+	// - the workers return once ctx is done
+	cancel()
+	running.Wait()
+
+	log.Println("TestHooks finished")
+}
+
+func TestCrawlerHooks(t *testing.T) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	out, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(out)
+
+	mem := NewResultMemory()
+	config := Configuration{
+		cores:       runtime.NumCPU(),
+		directories: []string{root},
+		maxinotify:  1024,
+		hooks: []Hook{
+			{name: "copy", glob: "*.md", kinds: CHANGE_CREATED | CHANGE_MODIFIED, command: []string{"cp", "{path}", out}},
+		},
+	}
+
+	crawler := startCrawler(testCrawler{mem: mem, config: config})
+	defer crawler.stop()
+
+	for _, name := range []string{"README.md", "main.go"} {
+		if err := ioutil.WriteFile(path.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// - a file that arrives inside a new directory, like one that was extracted or cloned, is created too
+	docs := path.Join(root, "docs")
+	if err := os.Mkdir(docs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(docs, "NOTES.md"), []byte("NOTES.md"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		_, readmeerr := os.Stat(path.Join(out, "README.md"))
+		_, noteserr := os.Stat(path.Join(out, "NOTES.md"))
+		if readmeerr == nil && noteserr == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if _, err := os.Stat(path.Join(out, "README.md")); err != nil {
+		t.Error("hook did not run for", path.Join(root, "README.md"))
+	}
+	if _, err := os.Stat(path.Join(out, "NOTES.md")); err != nil {
+		t.Error("hook did not run for", path.Join(docs, "NOTES.md"), "inside a new directory")
+	}
+	if _, err := os.Stat(path.Join(out, "main.go")); err == nil {
+		t.Error("hook ran for", path.Join(root, "main.go"))
+	}
+
+	log.Println("TestCrawlerHooks finished")
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// - increase this whenever the layout of Index changes, an index with a different version is ignored
+// and everything is crawled from scratch
+const INDEX_VERSION int = 4
+
+type IndexedFile struct {
+	Name    string
+	ModTime time.Time
+	Size    int64
+	Mode    os.FileMode
+	Uid     uint32
+	Gid     uint32
+	Inode   uint64
+	Device  uint64
+	Nlink   uint64
+}
+
+type IndexedDir struct {
+	Path    string
+	ModTime time.Time
+	Self    IndexedFile
+	Files   []IndexedFile
+	Linked  bool
+}
+
+type Index struct {
+	Version     int
+	Created     time.Time
+	Directories []IndexedDir
+}
+
+func IndexPath() string {
+	cachedir := os.Getenv("XDG_CACHE_HOME")
+	if cachedir == "" {
+		cachedir = path.Join(os.Getenv("HOME"), ".cache")
+	}
+	return path.Join(cachedir, "golocate", "index.gob.gz")
+}
+
+// - the index is written to a temporary file first and then renamed, so that a crash while saving
+// never leaves a broken index behind
+func SaveIndex(filename string, direntries *sync.Map) error {
+	index := Index{
+		Version: INDEX_VERSION,
+		Created: time.Now(),
+	}
+
+	direntries.Range(func(key, value interface{}) bool {
+		direntry := value.(*DirEntry)
+		indexeddir := IndexedDir{
+			Path:    direntry.path,
+			ModTime: direntry.modtime,
+			Files:   make([]IndexedFile, len(direntry.files)),
+			Linked:  direntry.linked,
+		}
+		if entry := direntry.self; entry != nil {
+			indexeddir.Self = IndexedFile{entry.name, entry.modtime, entry.size, entry.mode, entry.uid, entry.gid, entry.inode, entry.device, entry.nlink}
+		}
+		for i, entry := range direntry.files {
+			indexeddir.Files[i] = IndexedFile{entry.name, entry.modtime, entry.size, entry.mode, entry.uid, entry.gid, entry.inode, entry.device, entry.nlink}
+		}
+		index.Directories = append(index.Directories, indexeddir)
+		return true
+	})
+
+	if err := os.MkdirAll(path.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(path.Dir(filename), path.Base(filename))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	writer := gzip.NewWriter(file)
+	if err := gob.NewEncoder(writer).Encode(index); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), filename)
+}
+
+func LoadIndex(filename string) ([]*DirEntry, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var index Index
+	if err := gob.NewDecoder(reader).Decode(&index); err != nil {
+		return nil, err
+	}
+
+	if index.Version != INDEX_VERSION {
+		return nil, fmt.Errorf("index version %d, expected %d", index.Version, INDEX_VERSION)
+	}
+
+	direntries := make([]*DirEntry, len(index.Directories))
+	for i, indexeddir := range index.Directories {
+		direntry := &DirEntry{
+			path:    indexeddir.Path,
+			modtime: indexeddir.ModTime,
+			files:   make([]*FileEntry, len(indexeddir.Files)),
+			linked:  indexeddir.Linked,
+		}
+		if indexeddir.Self.Name != "" {
+			direntry.self = indexedFileEntry(direntry, indexeddir.Self)
+			direntry.self.isself = true
+			direntry.device = direntry.self.device
+		}
+		for j, indexedfile := range indexeddir.Files {
+			direntry.files[j] = indexedFileEntry(direntry, indexedfile)
+		}
+		markLinked(direntry.linked, direntry.self, direntry.files)
+		direntries[i] = direntry
+	}
+
+	return direntries, nil
+}
+
+func indexedFileEntry(direntry *DirEntry, indexedfile IndexedFile) *FileEntry {
+	return &FileEntry{
+		direntry: direntry,
+		name:     indexedfile.Name,
+		modtime:  indexedfile.ModTime,
+		size:     indexedfile.Size,
+		mode:     indexedfile.Mode,
+		uid:      indexedfile.Uid,
+		gid:      indexedfile.Gid,
+		inode:    indexedfile.Inode,
+		device:   indexedfile.Device,
+		nlink:    indexedfile.Nlink,
+	}
+}
+
+// - drops directories from a loaded index that are not below one of the configured directories anymore,
+// or that are excluded by the configured patterns, the .gitignore files are only read again while crawling
+// so they can't be used here, directories that were reached through links are dropped when we don't
+// follow links anymore
+func filterIndex(config Configuration, exclusions *Exclusions, filesystems *Filesystems, loaded []*DirEntry) []*DirEntry {
+	roots := make(map[string]bool, len(config.directories))
+	for _, dir := range config.directories {
+		roots[dir] = true
+	}
+
+	var result []*DirEntry
+	for _, direntry := range loaded {
+		keep := false
+		for dir := direntry.path; ; dir = path.Dir(dir) {
+			if roots[dir] {
+				keep = true
+				break
+			}
+
+			if excluded(exclusions.patterns, dir, true) || dir == "/" || dir == "." {
+				break
+			}
+		}
+
+		if keep && filesystems.Allowed(direntry.path) && (config.followsymlinks || !direntry.linked) {
+			result = append(result, direntry)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"runtime"
+	"sync"
+	"time"
+
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	direntries := new(sync.Map)
+	direntries.Store("/a", &DirEntry{
+		path:    "/a",
+		modtime: now,
+		self:    &FileEntry{direntry: &DirEntry{path: "/"}, name: "a", modtime: now, mode: os.ModeDir | 0755, inode: 7},
+		files: []*FileEntry{
+			{direntry: &DirEntry{path: "/a"}, name: "x", modtime: now.Add(-time.Hour), size: 10, mode: 0644, uid: 1000, gid: 100, inode: 42, device: 2049, nlink: 1},
+			{direntry: &DirEntry{path: "/a"}, name: "y", modtime: now.Add(-time.Minute), size: 20},
+		},
+	})
+	direntries.Store("/a/b", &DirEntry{
+		path:    "/a/b",
+		modtime: now.Add(-time.Hour),
+	})
+
+	filename := path.Join(dir, "index.gob.gz")
+	if err := SaveIndex(filename, direntries); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadIndex(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded) != 2 {
+		t.Fatal("expected 2 directories in index, got", len(loaded))
+	}
+
+	for _, direntry := range loaded {
+		value, ok := direntries.Load(direntry.path)
+		if !ok {
+			t.Error("unexpected directory in index", direntry.path)
+			continue
+		}
+
+		original := value.(*DirEntry)
+		if !original.modtime.Equal(direntry.modtime) || len(original.files) != len(direntry.files) {
+			t.Error("directory", direntry.path, "differs after loading")
+			continue
+		}
+
+		if original.self == nil && direntry.self != nil {
+			t.Error("directory", direntry.path, "has a row for itself after loading")
+		}
+		if self := direntry.self; original.self != nil &&
+			(self == nil || self.Dir() != original.self.Dir() || self.name != original.self.name || !self.modtime.Equal(original.self.modtime) ||
+				self.mode != original.self.mode || self.inode != original.self.inode) {
+			t.Error("row of directory", direntry.path, "differs after loading")
+		}
+
+		for i, entry := range direntry.files {
+			if !(entry.Dir() == original.files[i].Dir() && entry.name == original.files[i].name && entry.modtime.Equal(original.files[i].modtime) && entry.size == original.files[i].size &&
+				entry.mode == original.files[i].mode && entry.uid == original.files[i].uid && entry.gid == original.files[i].gid &&
+				entry.inode == original.files[i].inode && entry.device == original.files[i].device && entry.nlink == original.files[i].nlink) {
+				t.Error("file", entry.name, "differs after loading")
+			}
+		}
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := gzip.NewWriter(file)
+	gob.NewEncoder(writer).Encode(Index{Version: INDEX_VERSION + 1})
+	writer.Close()
+	file.Close()
+
+	if _, err := LoadIndex(filename); err == nil {
+		t.Error("loading an index with a different version should fail")
+	}
+
+	log.Println("TestIndex finished")
+}
+
+func TestWarmStart(t *testing.T) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	indexdir, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(indexdir)
+
+	writeFile := func(name string) {
+		if err := ioutil.WriteFile(path.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, subdir := range []string{"a", "b", "d"} {
+		if err := os.Mkdir(path.Join(root, subdir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("a/1")
+	writeFile("a/2")
+	writeFile("b/3")
+	writeFile("d/6")
+
+	direntries := new(sync.Map)
+	for _, dir := range []string{root, path.Join(root, "a"), path.Join(root, "b"), path.Join(root, "d")} {
+		direntry := &DirEntry{path: dir}
+		dirinfo, fileentries, _, err := readDir(nil, nil, nil, direntry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		direntry.modtime, direntry.files = dirinfo.ModTime(), fileentries
+		direntries.Store(dir, direntry)
+	}
+
+	filename := path.Join(indexdir, "index.gob.gz")
+	if err := SaveIndex(filename, direntries); err != nil {
+		t.Fatal(err)
+	}
+
+	// - make sure the modtimes of the changed directories differ from the ones in the index
+	time.Sleep(10 * time.Millisecond)
+	writeFile("a/4")
+	if err := os.RemoveAll(path.Join(root, "b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path.Join(root, "c"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile("c/5")
+
+	// - a file that is changed in place leaves the modtime of its directory alone
+	changed := path.Join(root, "d/6")
+	if err := ioutil.WriteFile(changed, []byte("changed in place"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changedtime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(changed, changedtime, changedtime); err != nil {
+		t.Fatal(err)
+	}
+
+	mem := NewResultMemory()
+	config := Configuration{
+		cores:       runtime.NumCPU(),
+		directories: []string{root},
+		maxinotify:  1024,
+		index:       filename,
+	}
+
+	startCrawler(testCrawler{mem: mem, config: config}).stop()
+
+	for _, sortcolumn := range []SortColumn{SORT_BY_NAME, SORT_BY_DIR, SORT_BY_MODTIME, SORT_BY_SIZE} {
+		found := make(map[string]bool)
+		dirs := make(map[string]bool)
+		for _, entry := range takeAll(mem.Column(sortcolumn), sortcolumn, DEFAULT_DIRECTION, nil, 100) {
+			if entry.IsDir() {
+				dirs[entry.name] = true
+			} else {
+				found[entry.name] = true
+			}
+			if entry.name == "6" && entry.size != int64(len("changed in place")) {
+				t.Error("file changed in place was not read again in column", sortcolumn, "size:", entry.size)
+			}
+		}
+
+		if len(found) != 5 || !found["1"] || !found["2"] || !found["4"] || !found["5"] || !found["6"] {
+			t.Error("unexpected files in column", sortcolumn, "after warm start:", found)
+		}
+		if len(dirs) != 4 || !dirs[path.Base(root)] || !dirs["a"] || !dirs["c"] || !dirs["d"] {
+			t.Error("unexpected directories in column", sortcolumn, "after warm start:", dirs)
+		}
+	}
+
+	log.Println("TestWarmStart finished")
+}
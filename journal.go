@@ -0,0 +1,309 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	JOURNAL_CAPACITY int = 100000
+	JOURNAL_VERSION  int = 1
+)
+
+type ChangeKind int
+
+const (
+	CHANGE_CREATED ChangeKind = 1 << iota
+	CHANGE_MODIFIED
+	CHANGE_DELETED
+	CHANGE_RENAMED
+
+	CHANGE_ALL = CHANGE_CREATED | CHANGE_MODIFIED | CHANGE_DELETED | CHANGE_RENAMED
+)
+
+func (kind ChangeKind) String() string {
+	switch kind {
+	case CHANGE_CREATED:
+		return "created"
+	case CHANGE_MODIFIED:
+		return "modified"
+	case CHANGE_DELETED:
+		return "deleted"
+	case CHANGE_RENAMED:
+		return "renamed"
+	default:
+		return fmt.Sprintf("ChangeKind(%d)", int(kind))
+	}
+}
+
+// - something that happened to a file or directory, oldpath is where it was before it was renamed
+type Change struct {
+	time    time.Time
+	kind    ChangeKind
+	path    string
+	oldpath string
+	isdir   bool
+}
+
+// - the last changes that were applied to the index, in a ring buffer that overwrites the oldest change
+// when it is full, the crawler records what it finds out about changes after it applied the events
+// from inotify and the poller, so a change that both saw is only recorded once, and a file that is
+// moved is recorded as renamed instead of as deleted and created, all methods can be called on a nil
+// *Journal
+// - unvisited are the directories that were recorded as created but whose contents were not read yet
+type Journal struct {
+	mutex     sync.Mutex
+	changes   []Change
+	next      int
+	full      bool
+	filename  string
+	unvisited map[string]bool
+}
+
+// - with an empty filename the journal is not persisted
+func NewJournal(capacity int, filename string) *Journal {
+	return &Journal{
+		changes:  make([]Change, capacity),
+		filename: filename,
+	}
+}
+
+func JournalPath() string {
+	return path.Join(path.Dir(IndexPath()), "journal.gob.gz")
+}
+
+func (journal *Journal) Record(kind ChangeKind, path string, oldpath string, isdir bool) {
+	if journal == nil || len(journal.changes) == 0 {
+		return
+	}
+
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	journal.record(Change{time.Now(), kind, path, oldpath, isdir})
+}
+
+func (journal *Journal) record(change Change) {
+	journal.changes[journal.next] = change
+	journal.next = (journal.next + 1) % len(journal.changes)
+	if journal.next == 0 {
+		journal.full = true
+	}
+}
+
+// - records that dir was created after the initial crawl, or moved in from somewhere we don't crawl, it is
+// visited afterwards, and everything that is found inside it then is recorded as created as well
+func (journal *Journal) Created(dir string) {
+	if journal == nil || len(journal.changes) == 0 {
+		return
+	}
+
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	journal.record(Change{time.Now(), CHANGE_CREATED, dir, "", true})
+	if journal.unvisited == nil {
+		journal.unvisited = make(map[string]bool)
+	}
+	journal.unvisited[dir] = true
+}
+
+// - called when dir is visited, returns true if dir was recorded as created, then its subdirectories are
+// recorded as created too, and the caller records its files once they were stat'ed, a dir that could
+// not be read is visited with no subdirectories
+func (journal *Journal) Visited(dir string, subdirs []string) bool {
+	if journal == nil {
+		return false
+	}
+
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	if !journal.unvisited[dir] {
+		return false
+	}
+	delete(journal.unvisited, dir)
+
+	now := time.Now()
+	for _, subdir := range subdirs {
+		journal.record(Change{now, CHANGE_CREATED, subdir, "", true})
+		journal.unvisited[subdir] = true
+	}
+	return true
+}
+
+// - records the difference between the entries of a directory before and after it was read again, an
+// entry that was removed and added under the same path was modified
+func (journal *Journal) Diff(removed []*FileEntry, added []*FileEntry) {
+	if journal == nil || len(removed)+len(added) == 0 {
+		return
+	}
+
+	removedpaths := make(map[string]bool, len(removed))
+	for _, entry := range removed {
+		removedpaths[path.Join(entry.Dir(), entry.name)] = true
+	}
+
+	addedpaths := make(map[string]bool, len(added))
+	for _, entry := range added {
+		entrypath := path.Join(entry.Dir(), entry.name)
+		addedpaths[entrypath] = true
+		if removedpaths[entrypath] {
+			journal.Record(CHANGE_MODIFIED, entrypath, "", entry.IsDir())
+		} else {
+			journal.Record(CHANGE_CREATED, entrypath, "", entry.IsDir())
+		}
+	}
+
+	for _, entry := range removed {
+		if entrypath := path.Join(entry.Dir(), entry.name); !addedpaths[entrypath] {
+			journal.Record(CHANGE_DELETED, entrypath, "", entry.IsDir())
+		}
+	}
+}
+
+func (journal *Journal) Len() int {
+	if journal == nil {
+		return 0
+	}
+
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	if journal.full {
+		return len(journal.changes)
+	}
+	return journal.next
+}
+
+// - returns the changes of the given kinds to dir or anything below it since the given time, most recent
+// first, a rename matches when it was renamed from or to somewhere below dir, an empty dir matches all
+func (journal *Journal) Query(dir string, kinds ChangeKind, since time.Time) []Change {
+	if journal == nil {
+		return nil
+	}
+
+	below := func(name string) bool {
+		return dir == "" || name == dir || strings.HasPrefix(name, strings.TrimSuffix(dir, "/")+"/")
+	}
+
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	n := journal.next
+	if journal.full {
+		n = len(journal.changes)
+	}
+
+	var result []Change
+	for i := 0; i < n; i++ {
+		change := journal.changes[(journal.next-1-i+len(journal.changes))%len(journal.changes)]
+		if change.time.Before(since) {
+			break
+		}
+		if change.kind&kinds != 0 && (below(change.path) || (change.oldpath != "" && below(change.oldpath))) {
+			result = append(result, change)
+		}
+	}
+	return result
+}
+
+type JournaledChange struct {
+	Time    time.Time
+	Kind    ChangeKind
+	Path    string
+	OldPath string
+	IsDir   bool
+}
+
+type JournalFile struct {
+	Version int
+	Changes []JournaledChange
+}
+
+// - written like the index, to a temporary file that is renamed afterwards
+func (journal *Journal) Save() error {
+	if journal == nil || journal.filename == "" {
+		return nil
+	}
+
+	journal.mutex.Lock()
+	journalfile := JournalFile{Version: JOURNAL_VERSION}
+	start, n := 0, journal.next
+	if journal.full {
+		start, n = journal.next, len(journal.changes)
+	}
+	for i := 0; i < n; i++ {
+		change := journal.changes[(start+i)%len(journal.changes)]
+		journalfile.Changes = append(journalfile.Changes, JournaledChange{change.time, change.kind, change.path, change.oldpath, change.isdir})
+	}
+	journal.mutex.Unlock()
+
+	if err := os.MkdirAll(path.Dir(journal.filename), 0755); err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(path.Dir(journal.filename), path.Base(journal.filename))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	writer := gzip.NewWriter(file)
+	if err := gob.NewEncoder(writer).Encode(journalfile); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), journal.filename)
+}
+
+// - appends the changes from a saved journal, oldest first, so it should be called before anything is
+// recorded
+func (journal *Journal) Load() error {
+	if journal == nil || journal.filename == "" {
+		return nil
+	}
+
+	file, err := os.Open(journal.filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var journalfile JournalFile
+	if err := gob.NewDecoder(reader).Decode(&journalfile); err != nil {
+		return err
+	}
+
+	if journalfile.Version != JOURNAL_VERSION {
+		return fmt.Errorf("journal version %d, expected %d", journalfile.Version, JOURNAL_VERSION)
+	}
+
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	for _, change := range journalfile.Changes {
+		if len(journal.changes) > 0 {
+			journal.record(Change{change.Time, change.Kind, change.Path, change.OldPath, change.IsDir})
+		}
+	}
+	return nil
+}
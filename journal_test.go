@@ -0,0 +1,200 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"runtime"
+	"time"
+
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	journal := NewJournal(4, "")
+	for _, name := range []string{"/a/1", "/a/2", "/b/3", "/a/4", "/b/5"} {
+		journal.Record(CHANGE_DELETED, name, "", false)
+	}
+
+	// - the oldest change was overwritten
+	if journal.Len() != 4 {
+		t.Error("expected", 4, "changes, got", journal.Len())
+	}
+	changes := journal.Query("", CHANGE_ALL, time.Time{})
+	if len(changes) != 4 || changes[0].path != "/b/5" || changes[3].path != "/a/2" {
+		t.Error("expected the last four changes, most recent first, got", changes)
+	}
+	if changes := journal.Query("/a", CHANGE_DELETED, time.Time{}); len(changes) != 2 {
+		t.Error("expected two deletions below /a, got", changes)
+	}
+	if changes := journal.Query("/a", CHANGE_CREATED, time.Time{}); len(changes) != 0 {
+		t.Error("expected no creations below /a, got", changes)
+	}
+	if changes := journal.Query("/", CHANGE_ALL, time.Now().Add(time.Hour)); len(changes) != 0 {
+		t.Error("expected no changes in the future, got", changes)
+	}
+
+	// - a rename is found below the directory it came from and below the one it went to
+	journal.Record(CHANGE_RENAMED, "/c/6", "/a/6", false)
+	if changes := journal.Query("/a", CHANGE_RENAMED, time.Time{}); len(changes) != 1 || changes[0].oldpath != "/a/6" {
+		t.Error("rename not found below its old directory:", changes)
+	}
+	if changes := journal.Query("/c/", CHANGE_RENAMED, time.Time{}); len(changes) != 1 {
+		t.Error("rename not found below its new directory:", changes)
+	}
+	if changes := journal.Query("/c/6/x", CHANGE_ALL, time.Time{}); len(changes) != 0 {
+		t.Error("rename found below a directory it is not in:", changes)
+	}
+
+	now := time.Now()
+	journal = NewJournal(10, "")
+	journal.Diff(
+		[]*FileEntry{{direntry: &DirEntry{path: "/d"}, name: "changed", modtime: now}, {direntry: &DirEntry{path: "/d"}, name: "deleted", modtime: now}},
+		[]*FileEntry{{direntry: &DirEntry{path: "/d"}, name: "changed", modtime: now}, {direntry: &DirEntry{path: "/d"}, name: "created", modtime: now}})
+	kinds := make(map[string]ChangeKind)
+	for _, change := range journal.Query("/d", CHANGE_ALL, time.Time{}) {
+		kinds[path.Base(change.path)] = change.kind
+	}
+	if kinds["changed"] != CHANGE_MODIFIED || kinds["deleted"] != CHANGE_DELETED || kinds["created"] != CHANGE_CREATED {
+		t.Error("unexpected changes from diff:", kinds)
+	}
+
+	var niljournal *Journal
+	niljournal.Record(CHANGE_CREATED, "/a", "", true)
+	if niljournal.Len() != 0 || niljournal.Query("", CHANGE_ALL, time.Time{}) != nil || niljournal.Save() != nil {
+		t.Error("nil journal should record nothing")
+	}
+
+	log.Println("TestJournal finished")
+}
+
+func TestSaveJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "journal.gob.gz")
+
+	journal := NewJournal(3, filename)
+	for _, name := range []string{"/1", "/2", "/3", "/4"} {
+		journal.Record(CHANGE_CREATED, name, "", false)
+	}
+	journal.Record(CHANGE_RENAMED, "/5", "/4", true)
+	if err := journal.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewJournal(3, filename)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	expected, changes := journal.Query("", CHANGE_ALL, time.Time{}), loaded.Query("", CHANGE_ALL, time.Time{})
+	if len(changes) != len(expected) {
+		t.Fatal("expected", len(expected), "changes, loaded", len(changes))
+	}
+	for i := range changes {
+		if changes[i].path != expected[i].path || changes[i].oldpath != expected[i].oldpath || changes[i].kind != expected[i].kind ||
+			changes[i].isdir != expected[i].isdir || !changes[i].time.Equal(expected[i].time) {
+			t.Error("loaded", changes[i], "instead of", expected[i])
+		}
+	}
+
+	if err := NewJournal(3, path.Join(dir, "missing")).Load(); !os.IsNotExist(err) {
+		t.Error("expected a missing journal to be reported as not existing, got", err)
+	}
+
+	log.Println("TestSaveJournal finished")
+}
+
+func TestCrawlerJournal(t *testing.T) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	a, b := path.Join(root, "a"), path.Join(root, "b")
+	for _, dir := range []string{a, b} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{path.Join(a, "1"), path.Join(b, "2")} {
+		if err := ioutil.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mem := NewResultMemory()
+	config := Configuration{
+		cores:       runtime.NumCPU(),
+		directories: []string{root},
+		maxinotify:  1024,
+	}
+	journal := NewJournal(100, "")
+
+	crawler := startCrawler(testCrawler{mem: mem, config: config, journal: journal})
+	defer crawler.stop()
+
+	if journal.Len() != 0 {
+		t.Error("the initial crawl should not be recorded, got", journal.Query("", CHANGE_ALL, time.Time{}))
+	}
+
+	// - c is created first, a new directory could get the inode of b otherwise and would look like b was
+	// renamed to it
+	start := time.Now()
+	c := path.Join(root, "c")
+	if err := os.MkdirAll(path.Join(c, "d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{path.Join(c, "4"), path.Join(c, "d", "5")} {
+		if err := ioutil.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.RemoveAll(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path.Join(a, "1"), path.Join(a, "3")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]ChangeKind{
+		path.Join(b, "2"):      CHANGE_DELETED,
+		b:                      CHANGE_DELETED,
+		path.Join(a, "3"):      CHANGE_RENAMED,
+		c:                      CHANGE_CREATED,
+		path.Join(c, "4"):      CHANGE_CREATED,
+		path.Join(c, "d"):      CHANGE_CREATED,
+		path.Join(c, "d", "5"): CHANGE_CREATED,
+	}
+
+	var found map[string]ChangeKind
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		found = make(map[string]ChangeKind)
+		for _, change := range journal.Query(root, CHANGE_ALL, start) {
+			found[change.path] |= change.kind
+		}
+		if len(found) == len(expected) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	for name, kind := range expected {
+		if found[name] != kind {
+			t.Error("expected", name, "to be", kind, "got", found[name])
+		}
+	}
+	if deleted := journal.Query(b, CHANGE_DELETED, start); len(deleted) != 2 {
+		t.Error("expected two deletions below", b, "got", deleted)
+	}
+	if created := journal.Query(c, CHANGE_CREATED, start); len(created) != 4 {
+		t.Error("expected", c, "and everything inside it to be created once, got", created)
+	}
+
+	log.Println("TestCrawlerJournal finished")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path"
+	"sync"
+	"syscall"
+)
+
+// - with followsymlinks a symbolic link to a directory is crawled like a directory, everything below it
+// keeps the path through the link and is marked as linked, a nil *Links follows no links at all
+// - every directory that is listed is recorded by device and inode, a link to a directory that was
+// recorded under another path already is not followed, that stops cycles, and it stops us from
+// crawling a directory twice when it is linked from inside a directory we crawl anyway
+type Links struct {
+	mutex     sync.Mutex
+	dirs      map[inodeKey]string
+	linkpaths map[string]bool
+}
+
+func NewLinks() *Links {
+	return &Links{
+		dirs:      make(map[inodeKey]string),
+		linkpaths: make(map[string]bool),
+	}
+}
+
+func statInodeKey(info os.FileInfo) inodeKey {
+	stat := info.Sys().(*syscall.Stat_t)
+	return inodeKey{stat.Dev, stat.Ino}
+}
+
+// - the path other then dir under which the directory with key was recorded, if that path still leads to
+// the directory, the directory we recorded may have been removed since, and its inode may belong to another
+// one now, must be called with the mutex held
+func (links *Links) claimed(key inodeKey, dir string) (string, bool) {
+	claimed, ok := links.dirs[key]
+	if !ok || claimed == dir {
+		return "", false
+	}
+	info, err := os.Stat(claimed)
+	return claimed, err == nil && statInodeKey(info) == key
+}
+
+// - records that the directory with key is listed under dir, the first path that is recorded wins, returns
+// false if that path was reached through a followed link, then the directory is crawled below the link
+// already, which happens when a link points to a directory inside the roots that we did not reach yet
+func (links *Links) Visit(dir string, key inodeKey) bool {
+	if links == nil {
+		return true
+	}
+
+	links.mutex.Lock()
+	defer links.mutex.Unlock()
+	if claimed, ok := links.claimed(key, dir); ok {
+		return !links.linked(claimed)
+	}
+	links.dirs[key] = dir
+	return true
+}
+
+// - called for every symbolic link found while listing a directory, returns true if linkpath points to
+// a directory that we have not seen under another path yet
+func (links *Links) Follow(linkpath string) bool {
+	if links == nil {
+		return false
+	}
+
+	info, err := os.Stat(linkpath)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	key := statInodeKey(info)
+
+	// - the mutex is held from looking up key until it is recorded, so that two directories that are listed
+	// at the same time can't both follow a link to the same directory
+	links.mutex.Lock()
+	defer links.mutex.Unlock()
+	if _, ok := links.claimed(key, linkpath); ok {
+		return false
+	}
+	links.dirs[key] = linkpath
+	links.linkpaths[linkpath] = true
+	return true
+}
+
+// - returns true if dir was reached through a link that we followed, which is the case when dir or one
+// of its parents is such a link, and that link still is a link
+func (links *Links) Linked(dir string) bool {
+	if links == nil {
+		return false
+	}
+
+	links.mutex.Lock()
+	defer links.mutex.Unlock()
+	return links.linked(dir)
+}
+
+// - links that were replaced by something else are forgotten, must be called with the mutex held
+func (links *Links) linked(dir string) bool {
+	for ; dir != "/" && dir != "."; dir = path.Dir(dir) {
+		if !links.linkpaths[dir] {
+			continue
+		}
+		if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return true
+		}
+		delete(links.linkpaths, dir)
+	}
+	return false
+}
+
+// - records a directory loaded from the index like it was listed, and remembers the link it was reached
+// through if it is that link itself
+func (links *Links) Restore(direntry *DirEntry) {
+	if links == nil || direntry.self == nil {
+		return
+	}
+
+	links.Visit(direntry.path, inodeKey{direntry.self.device, direntry.self.inode})
+	if direntry.linked {
+		if info, err := os.Lstat(direntry.path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			links.mutex.Lock()
+			links.linkpaths[direntry.path] = true
+			links.mutex.Unlock()
+		}
+	}
+}
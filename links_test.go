@@ -0,0 +1,174 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"runtime"
+
+	"testing"
+)
+
+// - root/a/1, root/a/tofile -> root/a/1, root/a/ext -> outside, root/a/ext2 -> outside, outside/x/2,
+// outside/x/back -> root/a, outside/x/self -> outside
+func makeLinkedTree(t *testing.T) (string, string) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// - d is linked from the root, so the link is usually listed before d itself is reached
+	a, x, d := path.Join(root, "a"), path.Join(outside, "x"), path.Join(root, "deep", "deeper", "d")
+	for _, dir := range []string{a, x, d} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{path.Join(a, "1"), path.Join(x, "2"), path.Join(d, "3")} {
+		if err := ioutil.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		path.Join(a, "tofile"): path.Join(a, "1"),
+		path.Join(a, "ext"):    outside,
+		path.Join(a, "ext2"):   outside,
+		path.Join(x, "back"):   a,
+		path.Join(x, "self"):   outside,
+		path.Join(root, "d"):   d,
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root, outside
+}
+
+func TestLinks(t *testing.T) {
+	root, outside := makeLinkedTree(t)
+	defer os.RemoveAll(root)
+	defer os.RemoveAll(outside)
+	a := path.Join(root, "a")
+
+	_, names, subdirs, err := listDir(nil, nil, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subdirs) != 0 || len(names) != 4 {
+		t.Error("links should be files without following them:", names, subdirs)
+	}
+
+	links := NewLinks()
+	_, names, subdirs, err = listDir(nil, links, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// - only one of the two links to outside is followed, the link to a file stays a file
+	if len(subdirs) != 1 || (subdirs[0] != path.Join(a, "ext") && subdirs[0] != path.Join(a, "ext2")) {
+		t.Error("expected one followed link to", outside, "got", subdirs)
+	}
+	if len(names) != 3 {
+		t.Error("expected the file, the link to it and the link that was not followed, got", names)
+	}
+
+	linked := path.Join(subdirs[0], "x")
+	if !links.Linked(subdirs[0]) || !links.Linked(linked) || links.Linked(a) {
+		t.Error("Linked does not match the followed link", subdirs[0])
+	}
+
+	// - the directory the followed link points to is not listed again under its own path
+	if info, err := os.Stat(outside); err != nil || links.Visit(outside, statInodeKey(info)) {
+		t.Error("directory below a followed link would be listed again under", outside)
+	}
+
+	// - both links below the linked directory point to directories that were listed or followed already
+	_, names, subdirs, err = listDir(nil, links, linked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subdirs) != 0 || len(names) != 3 {
+		t.Error("links back to listed directories should not be followed:", names, subdirs)
+	}
+
+	// - a followed link that is replaced by a directory is not linked anymore
+	for _, name := range []string{"ext", "ext2"} {
+		if err := os.Remove(path.Join(a, name)); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(path.Join(a, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if links.Linked(path.Join(a, name)) {
+			t.Error("directory that replaced the link", name, "is still linked")
+		}
+	}
+
+	var nillinks *Links
+	if nillinks.Follow(path.Join(a, "ext")) || nillinks.Linked(a) {
+		t.Error("nil links should not follow anything")
+	}
+
+	log.Println("TestLinks finished")
+}
+
+func TestCrawlerFollowLinks(t *testing.T) {
+	root, outside := makeLinkedTree(t)
+	defer os.RemoveAll(root)
+	defer os.RemoveAll(outside)
+	a := path.Join(root, "a")
+
+	mem := NewResultMemory()
+	config := Configuration{
+		cores:          runtime.NumCPU(),
+		directories:    []string{root},
+		maxinotify:     1024,
+		followsymlinks: true,
+	}
+
+	crawler := startCrawler(testCrawler{mem: mem, config: config})
+	defer crawler.stop()
+
+	var found, inner []*FileEntry
+	dirs := make(map[string]*FileEntry)
+	for _, entry := range takeAll(mem.Column(SORT_BY_NAME), SORT_BY_NAME, DEFAULT_DIRECTION, nil, 100) {
+		if entry.name == "2" {
+			found = append(found, entry)
+		}
+		if entry.name == "3" {
+			inner = append(inner, entry)
+		}
+		if entry.IsDir() {
+			dirs[path.Join(entry.Dir(), entry.name)] = entry
+		}
+	}
+
+	if len(found) != 1 {
+		t.Fatal("expected file below the linked directory exactly once, got", len(found))
+	}
+	if found[0].Dir() != path.Join(a, "ext", "x") && found[0].Dir() != path.Join(a, "ext2", "x") {
+		t.Error("file below the linked directory is not shown under the path of the link:", found[0].Dir())
+	}
+	if !found[0].linked || !dirs[found[0].Dir()].linked || !dirs[path.Dir(found[0].Dir())].linked {
+		t.Error("entries reached through a link are not marked as linked")
+	}
+	if dirs[a] == nil || dirs[a].linked || findEntry(mem, SORT_BY_NAME, a, "1").linked {
+		t.Error("entries not reached through a link are marked as linked")
+	}
+	// - a directory inside the root that is linked from the root is crawled once, either below the link or
+	// under its own path, whichever was reached first
+	if len(inner) != 1 {
+		t.Error("expected file below the directory that is linked from the root exactly once, got", len(inner))
+	}
+	if len(dirs) != 7 {
+		t.Error("expected root, a, the followed link, x, deep, deeper and d or its link as directories, got", len(dirs))
+	}
+
+	log.Println("TestCrawlerFollowLinks finished")
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	unix "golang.org/x/sys/unix"
+)
+
+type FileType int
+
+const (
+	FILETYPE_REGULAR FileType = iota
+	FILETYPE_SYMLINK
+	FILETYPE_FIFO
+	FILETYPE_SOCKET
+	FILETYPE_CHARDEVICE
+	FILETYPE_BLOCKDEVICE
+	FILETYPE_DIRECTORY
+	FILETYPE_OTHER
+)
+
+func (filetype FileType) String() string {
+	switch filetype {
+	case FILETYPE_REGULAR:
+		return "file"
+	case FILETYPE_SYMLINK:
+		return "symlink"
+	case FILETYPE_FIFO:
+		return "fifo"
+	case FILETYPE_SOCKET:
+		return "socket"
+	case FILETYPE_CHARDEVICE:
+		return "char device"
+	case FILETYPE_BLOCKDEVICE:
+		return "block device"
+	case FILETYPE_DIRECTORY:
+		return "directory"
+	default:
+		return "other"
+	}
+}
+
+// - converts the st_mode of a stat into an os.FileMode, the same way os.Lstat does it
+func fileModeFromStat(mode uint32) os.FileMode {
+	filemode := os.FileMode(mode & 0777)
+
+	switch mode & unix.S_IFMT {
+	case unix.S_IFLNK:
+		filemode |= os.ModeSymlink
+	case unix.S_IFIFO:
+		filemode |= os.ModeNamedPipe
+	case unix.S_IFSOCK:
+		filemode |= os.ModeSocket
+	case unix.S_IFCHR:
+		filemode |= os.ModeDevice | os.ModeCharDevice
+	case unix.S_IFBLK:
+		filemode |= os.ModeDevice
+	case unix.S_IFDIR:
+		filemode |= os.ModeDir
+	}
+
+	if mode&unix.S_ISUID != 0 {
+		filemode |= os.ModeSetuid
+	}
+	if mode&unix.S_ISGID != 0 {
+		filemode |= os.ModeSetgid
+	}
+	if mode&unix.S_ISVTX != 0 {
+		filemode |= os.ModeSticky
+	}
+
+	return filemode
+}
+
+func fileTypeFromMode(mode os.FileMode) FileType {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return FILETYPE_SYMLINK
+	case mode&os.ModeNamedPipe != 0:
+		return FILETYPE_FIFO
+	case mode&os.ModeSocket != 0:
+		return FILETYPE_SOCKET
+	case mode&os.ModeCharDevice != 0:
+		return FILETYPE_CHARDEVICE
+	case mode&os.ModeDevice != 0:
+		return FILETYPE_BLOCKDEVICE
+	case mode&os.ModeDir != 0:
+		return FILETYPE_DIRECTORY
+	case mode.IsRegular():
+		return FILETYPE_REGULAR
+	default:
+		return FILETYPE_OTHER
+	}
+}
+
+func (entry *FileEntry) FileType() FileType {
+	return fileTypeFromMode(entry.mode)
+}
+
+func newFileEntry(direntry *DirEntry, name string, stat *unix.Stat_t) *FileEntry {
+	return &FileEntry{
+		direntry: direntry,
+		name:     name,
+		modtime:  time.Unix(stat.Mtim.Unix()),
+		size:     stat.Size,
+		mode:     fileModeFromStat(stat.Mode),
+		uid:      stat.Uid,
+		gid:      stat.Gid,
+		inode:    stat.Ino,
+		device:   stat.Dev,
+		nlink:    uint64(stat.Nlink),
+	}
+}
+
+// - the entry that represents a directory itself in the index, its size is zero, how much is stored
+// below it is kept in recursivesize when that is enabled
+func newDirFileEntry(direntry *DirEntry, dirinfo os.FileInfo) *FileEntry {
+	entry := &FileEntry{
+		direntry: direntry,
+		isself:   true,
+		name:     path.Base(direntry.path),
+		modtime:  dirinfo.ModTime(),
+		mode:     dirinfo.Mode(),
+	}
+
+	if stat, ok := dirinfo.Sys().(*syscall.Stat_t); ok {
+		entry.uid = stat.Uid
+		entry.gid = stat.Gid
+		entry.inode = stat.Ino
+		entry.device = stat.Dev
+		entry.nlink = uint64(stat.Nlink)
+	}
+
+	return entry
+}
+
+func (entry *FileEntry) IsDir() bool {
+	return entry.mode&os.ModeDir != 0
+}
+
+func (entry *FileEntry) RecursiveSize() int64 {
+	return atomic.LoadInt64(&entry.recursivesize)
+}
+
+// - sums up the sizes of all files below every directory, deepest directories first so that every
+// directory only has to add the totals of its direct children
+func updateRecursiveSizes(direntries *sync.Map) {
+	sizes := make(map[string]int64)
+	var dirs []*DirEntry
+	direntries.Range(func(key, value interface{}) bool {
+		direntry := value.(*DirEntry)
+		dirs = append(dirs, direntry)
+		for _, entry := range direntry.files {
+			if !entry.IsAlias() {
+				sizes[direntry.path] += entry.size
+			}
+		}
+		return true
+	})
+
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i].path, "/") > strings.Count(dirs[j].path, "/")
+	})
+
+	// - a directory that is an alias, because it is bind mounted somewhere else, has only aliases below it
+	for _, direntry := range dirs {
+		parent := path.Dir(direntry.path)
+		if _, known := sizes[parent]; known && parent != direntry.path && (direntry.self == nil || !direntry.self.IsAlias()) {
+			sizes[parent] += sizes[direntry.path]
+		}
+	}
+
+	for _, direntry := range dirs {
+		if direntry.self != nil {
+			atomic.StoreInt64(&direntry.self.recursivesize, sizes[direntry.path])
+		}
+	}
+}
+
+type EntryFilter int
+
+const (
+	FILTER_ALL EntryFilter = iota
+	FILTER_FILES
+	FILTER_DIRECTORIES
+)
+
+// - aliases are never accepted, they are listed in the details of their canonical entry instead
+func (filter EntryFilter) Accept(entry *FileEntry) bool {
+	if entry.IsAlias() {
+		return false
+	}
+
+	switch filter {
+	case FILTER_FILES:
+		return !entry.IsDir()
+	case FILTER_DIRECTORIES:
+		return entry.IsDir()
+	default:
+		return true
+	}
+}
+
+// - looking up user and group names reads /etc/passwd and /etc/group, or asks nss, so we cache the
+// names, ids that have no name are shown as numbers
+var (
+	usernames  sync.Map
+	groupnames sync.Map
+)
+
+func lookupUserName(uid uint32) string {
+	if name, ok := usernames.Load(uid); ok {
+		return name.(string)
+	}
+
+	id := strconv.FormatUint(uint64(uid), 10)
+	name := id
+	if found, err := user.LookupId(id); err == nil {
+		name = found.Username
+	}
+	usernames.Store(uid, name)
+	return name
+}
+
+func lookupGroupName(gid uint32) string {
+	if name, ok := groupnames.Load(gid); ok {
+		return name.(string)
+	}
+
+	id := strconv.FormatUint(uint64(gid), 10)
+	name := id
+	if found, err := user.LookupGroupId(id); err == nil {
+		name = found.Name
+	}
+	groupnames.Store(gid, name)
+	return name
+}
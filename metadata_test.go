@@ -0,0 +1,173 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+
+	unix "golang.org/x/sys/unix"
+
+	"testing"
+)
+
+func TestFileEntryMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(path.Join(dir, "regular"), []byte("regular"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(path.Join(dir, "regular"), path.Join(dir, "hardlink")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("regular", path.Join(dir, "symlink")); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Mkfifo(path.Join(dir, "fifo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("unix", path.Join(dir, "socket"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	_, fileentries, _, err := readDir(nil, nil, nil, &DirEntry{path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]FileType{
+		"regular":  FILETYPE_REGULAR,
+		"hardlink": FILETYPE_REGULAR,
+		"symlink":  FILETYPE_SYMLINK,
+		"fifo":     FILETYPE_FIFO,
+		"socket":   FILETYPE_SOCKET,
+	}
+
+	if len(fileentries) != len(expected) {
+		t.Fatal("expected", len(expected), "entries, got", len(fileentries))
+	}
+
+	for _, entry := range fileentries {
+		if filetype := entry.FileType(); filetype != expected[entry.name] {
+			t.Error("expected", entry.name, "to be a", expected[entry.name], "but it is a", filetype)
+		}
+
+		fileinfo, err := os.Lstat(path.Join(dir, entry.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stat := fileinfo.Sys().(*syscall.Stat_t)
+
+		if entry.mode != fileinfo.Mode() {
+			t.Error("mode of", entry.name, "is", entry.mode, "instead of", fileinfo.Mode())
+		}
+		if entry.uid != stat.Uid || entry.gid != stat.Gid || entry.inode != stat.Ino || entry.device != stat.Dev || entry.nlink != uint64(stat.Nlink) {
+			t.Error("unexpected metadata for", entry.name, entry.uid, entry.gid, entry.inode, entry.device, entry.nlink)
+		}
+
+		if (entry.name == "regular" || entry.name == "hardlink") && entry.nlink != 2 {
+			t.Error("expected 2 links for", entry.name, "got", entry.nlink)
+		}
+	}
+
+	if lookupUserName(uint32(os.Getuid())) == "" || lookupGroupName(uint32(os.Getgid())) == "" {
+		t.Error("could not look up user or group name")
+	}
+
+	log.Println("TestFileEntryMetadata finished")
+}
+
+func TestDiffFileEntriesMetadata(t *testing.T) {
+	entry := &FileEntry{direntry: &DirEntry{path: "/a"}, name: "x", size: 1, mode: 0644, inode: 1}
+	chmodded := &FileEntry{direntry: &DirEntry{path: "/a"}, name: "x", size: 1, mode: 0600, inode: 1}
+	replaced := &FileEntry{direntry: &DirEntry{path: "/a"}, name: "x", size: 1, mode: 0644, inode: 2}
+
+	for _, current := range []*FileEntry{chmodded, replaced} {
+		removed, added, kept := diffFileEntries([]*FileEntry{entry}, []*FileEntry{current})
+		if len(removed) != 1 || len(added) != 1 || len(kept) != 0 {
+			t.Error("expected changed metadata to replace the entry:", len(removed), len(added), len(kept))
+		}
+	}
+
+	log.Println("TestDiffFileEntriesMetadata finished")
+}
+
+func TestDirectoryRows(t *testing.T) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, subdir := range []string{"a", "a/b"} {
+		if err := os.Mkdir(path.Join(root, subdir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, size := range map[string]int{"1": 100, "a/2": 20, "a/b/3": 3} {
+		if err := ioutil.WriteFile(path.Join(root, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mem := NewResultMemory()
+
+	direntries := new(sync.Map)
+	for _, dir := range []string{root, path.Join(root, "a"), path.Join(root, "a/b")} {
+		direntry := &DirEntry{path: dir}
+		dirinfo, fileentries, _, err := readDir(nil, nil, nil, direntry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		direntry.modtime, direntry.files, direntry.self = dirinfo.ModTime(), fileentries, newDirFileEntry(direntry, dirinfo)
+		direntries.Store(dir, direntry)
+		mergeFiles(mem, append(fileentries, direntry.self))
+	}
+
+	updateRecursiveSizes(direntries)
+	expected := map[string]int64{root: 123, path.Join(root, "a"): 23, path.Join(root, "a/b"): 3}
+	for dir, size := range expected {
+		value, _ := direntries.Load(dir)
+		self := value.(*DirEntry).self
+		if self.Dir() != path.Dir(dir) || self.name != path.Base(dir) || self.FileType() != FILETYPE_DIRECTORY {
+			t.Error("unexpected row for directory", dir, self.Dir(), self.name, self.FileType())
+		}
+		if self.RecursiveSize() != size {
+			t.Error("expected recursive size", size, "for", dir, "got", self.RecursiveSize())
+		}
+	}
+
+	for filter, numentries := range map[EntryFilter]int{FILTER_ALL: 6, FILTER_FILES: 3, FILTER_DIRECTORIES: 3} {
+		for _, sortcolumn := range []SortColumn{SORT_BY_NAME, SORT_BY_DIR, SORT_BY_MODTIME, SORT_BY_SIZE} {
+			cache := MatchCaches{NewSimpleCache(), NewSimpleCache(), filter}
+			taken := make(chan *FileEntry)
+			go mem.Column(sortcolumn).Take(cache, sortcolumn, DEFAULT_DIRECTION, nil, 100, make(chan struct{}), taken)
+
+			var entries []*FileEntry
+			for entry := range taken {
+				if entry == nil {
+					break
+				}
+				if !filter.Accept(entry) {
+					t.Error("filter", filter, "accepted", entry.name)
+				}
+				entries = append(entries, entry)
+			}
+
+			if len(entries) != numentries {
+				t.Error("expected", numentries, "entries with filter", filter, "in column", sortcolumn, "got", len(entries))
+			}
+		}
+	}
+
+	log.Println("TestDirectoryRows finished")
+}
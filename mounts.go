@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	unix "golang.org/x/sys/unix"
+)
+
+const MOUNTINFO_PATH string = "/proc/self/mountinfo"
+
+// - filesystems that have nothing worth finding, or that would make us crawl the same files twice
+var DEFAULT_SKIPFSTYPES = []string{"proc", "sysfs", "devpts", "devtmpfs", "cgroup", "cgroup2", "debugfs", "tracefs",
+	"securityfs", "pstore", "bpf", "configfs", "fusectl", "mqueue", "hugetlbfs", "autofs", "binfmt_misc", "fuse.gvfsd-fuse", "fuse.portal"}
+
+// - inotify only sees changes made by this machine, so network filesystems are always polled
+var DEFAULT_POLLFSTYPES = []string{"nfs", "nfs4", "cifs", "smb3", "smbfs", "9p", "fuse.sshfs", "fuse.rclone", "ceph", "glusterfs"}
+
+type Mount struct {
+	id         int
+	parent     int
+	device     uint64
+	root       string
+	mountpoint string
+	fstype     string
+	source     string
+	options    string
+}
+
+// - paths in mountinfo have spaces, tabs, newlines and backslashes escaped as octal
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if octal, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				builder.WriteByte(byte(octal))
+				i += 3
+				continue
+			}
+		}
+		builder.WriteByte(s[i])
+	}
+	return builder.String()
+}
+
+// - every line looks like this, with a variable number of optional fields before the separator:
+// 36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func ParseMountInfo(reader io.Reader) ([]Mount, error) {
+	var mounts []Mount
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		separator := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				separator = i
+				break
+			}
+		}
+		if separator < 0 || separator+2 >= len(fields) {
+			return nil, fmt.Errorf("malformed mountinfo line: %s", scanner.Text())
+		}
+
+		id, iderr := strconv.Atoi(fields[0])
+		parent, parenterr := strconv.Atoi(fields[1])
+		var major, minor uint32
+		_, deverr := fmt.Sscanf(fields[2], "%d:%d", &major, &minor)
+		if iderr != nil || parenterr != nil || deverr != nil {
+			return nil, fmt.Errorf("malformed mountinfo line: %s", scanner.Text())
+		}
+
+		mounts = append(mounts, Mount{
+			id:         id,
+			parent:     parent,
+			device:     unix.Mkdev(major, minor),
+			root:       unescapeMountPath(fields[3]),
+			mountpoint: unescapeMountPath(fields[4]),
+			options:    fields[5],
+			fstype:     fields[separator+1],
+			source:     unescapeMountPath(fields[separator+2]),
+		})
+	}
+
+	return mounts, scanner.Err()
+}
+
+func ReadMountInfo() ([]Mount, error) {
+	file, err := os.Open(MOUNTINFO_PATH)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseMountInfo(file)
+}
+
+// - options that apply to every directory below one of the configured directories
+type RootOptions struct {
+	onefilesystem bool
+	skipfstypes   []string
+	pollfstypes   []string
+}
+
+func matchFsType(patterns []string, fstype string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, fstype); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// - decides which directories are crawled and which are polled, depending on which filesystem they are
+// on and which configured directory they are below, a nil *Filesystems allows everything
+// - mounts that match one of the automount patterns become roots of their own while they are mounted
+type Filesystems struct {
+	mutex       sync.RWMutex
+	mountpoints map[string]Mount
+	roots       []string
+	options     map[string]RootOptions
+	automount   map[string]RootOptions
+	automounted map[string]bool
+}
+
+func NewFilesystems(config Configuration, mounts []Mount) *Filesystems {
+	filesystems := &Filesystems{
+		roots:       append([]string(nil), config.directories...),
+		options:     make(map[string]RootOptions, len(config.rootoptions)),
+		automount:   config.automount,
+		automounted: make(map[string]bool),
+	}
+	for root, options := range config.rootoptions {
+		filesystems.options[root] = options
+	}
+	filesystems.Update(mounts)
+	return filesystems
+}
+
+// - replaces the known mounts and returns the ones that appeared and disappeared since the last update,
+// a mount point that got something else mounted on it shows up in both
+// - when something is mounted over an existing mount the later line in mountinfo is the one we see
+func (filesystems *Filesystems) Update(mounts []Mount) ([]Mount, []Mount) {
+	if filesystems == nil {
+		return nil, nil
+	}
+
+	mountpoints := make(map[string]Mount, len(mounts))
+	for _, mount := range mounts {
+		mountpoints[mount.mountpoint] = mount
+	}
+
+	filesystems.mutex.Lock()
+	defer filesystems.mutex.Unlock()
+
+	var appeared, disappeared []Mount
+	for mountpoint, mount := range mountpoints {
+		if old, ok := filesystems.mountpoints[mountpoint]; !ok || old.id != mount.id {
+			appeared = append(appeared, mount)
+		}
+	}
+	for mountpoint, old := range filesystems.mountpoints {
+		if mount, ok := mountpoints[mountpoint]; !ok || old.id != mount.id {
+			disappeared = append(disappeared, old)
+		}
+	}
+	sort.Slice(appeared, func(i, j int) bool { return appeared[i].mountpoint < appeared[j].mountpoint })
+	sort.Slice(disappeared, func(i, j int) bool { return disappeared[i].mountpoint < disappeared[j].mountpoint })
+
+	filesystems.mountpoints = mountpoints
+	return appeared, disappeared
+}
+
+func (filesystems *Filesystems) Roots() []string {
+	if filesystems == nil {
+		return nil
+	}
+
+	filesystems.mutex.RLock()
+	defer filesystems.mutex.RUnlock()
+	return append([]string(nil), filesystems.roots...)
+}
+
+// - makes mount a root if its mount point matches one of the automount patterns, returns true if it did
+func (filesystems *Filesystems) Automount(mount Mount) bool {
+	if filesystems == nil {
+		return false
+	}
+
+	filesystems.mutex.Lock()
+	defer filesystems.mutex.Unlock()
+
+	for _, root := range filesystems.roots {
+		if root == mount.mountpoint {
+			return false
+		}
+	}
+
+	for pattern, options := range filesystems.automount {
+		if matched, _ := path.Match(pattern, mount.mountpoint); matched {
+			filesystems.roots = append(filesystems.roots, mount.mountpoint)
+			filesystems.options[mount.mountpoint] = options
+			filesystems.automounted[mount.mountpoint] = true
+			return true
+		}
+	}
+
+	return false
+}
+
+// - removes a root that was added by Automount, returns false for every other mount point
+func (filesystems *Filesystems) Unmount(mountpoint string) bool {
+	if filesystems == nil {
+		return false
+	}
+
+	filesystems.mutex.Lock()
+	defer filesystems.mutex.Unlock()
+
+	if !filesystems.automounted[mountpoint] {
+		return false
+	}
+
+	for i, root := range filesystems.roots {
+		if root == mountpoint {
+			filesystems.roots = append(filesystems.roots[:i], filesystems.roots[i+1:]...)
+			break
+		}
+	}
+	delete(filesystems.options, mountpoint)
+	delete(filesystems.automounted, mountpoint)
+	return true
+}
+
+// - the mount a directory is on is the one mounted on the directory itself or on the closest parent
+func (filesystems *Filesystems) Mount(dir string) (Mount, bool) {
+	if filesystems == nil {
+		return Mount{}, false
+	}
+
+	filesystems.mutex.RLock()
+	defer filesystems.mutex.RUnlock()
+
+	for {
+		if mount, ok := filesystems.mountpoints[dir]; ok {
+			return mount, true
+		}
+
+		parent := path.Dir(dir)
+		if parent == dir {
+			return Mount{}, false
+		}
+		dir = parent
+	}
+}
+
+func (filesystems *Filesystems) rootOptions(dir string) (string, RootOptions) {
+	filesystems.mutex.RLock()
+	defer filesystems.mutex.RUnlock()
+
+	root := ""
+	for _, candidate := range filesystems.roots {
+		if (dir == candidate || strings.HasPrefix(dir, candidate+"/") || candidate == "/") && len(candidate) > len(root) {
+			root = candidate
+		}
+	}
+	return root, filesystems.options[root]
+}
+
+func (filesystems *Filesystems) Allowed(dir string) bool {
+	if filesystems == nil {
+		return true
+	}
+
+	mount, ok := filesystems.Mount(dir)
+	if !ok {
+		return true
+	}
+
+	root, options := filesystems.rootOptions(dir)
+	if matchFsType(options.skipfstypes, mount.fstype) {
+		return false
+	}
+
+	if options.onefilesystem && root != "" {
+		if rootmount, ok := filesystems.Mount(root); ok && rootmount.id != mount.id {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (filesystems *Filesystems) Polled(dir string) bool {
+	if filesystems == nil {
+		return false
+	}
+
+	mount, ok := filesystems.Mount(dir)
+	if !ok {
+		return false
+	}
+
+	_, options := filesystems.rootOptions(dir)
+	return matchFsType(options.pollfstypes, mount.fstype)
+}
+
+// - applies mounts that appeared or disappeared since the last call, automounted roots are crawled when they
+// appear and removed from mem when they disappear, a mount on a directory that we know already changes
+// what is in it, so it is updated, or removed if it is on a filesystem we don't crawl, and a mount on a
+// directory that we don't know yet may make it appear when its parent is updated
+// - what appears or disappears with a mount was not created or deleted, so none of it is journaled
+// - returns true if anything changed
+func updateMounts(ctx context.Context, wg *sync.WaitGroup, mem ResultMemory, exclusions *Exclusions, links *Links, direntries *sync.Map, watches *Watches, stats *CrawlStats, newdirs chan string, filesystems *Filesystems, mounts []Mount) bool {
+	appeared, disappeared := filesystems.Update(mounts)
+
+	changed := func(mount Mount) {
+		if value, known := direntries.Load(mount.mountpoint); known {
+			direntry := value.(*DirEntry)
+			if !filesystems.Allowed(mount.mountpoint) {
+				removeDirectory(mem, direntries, watches, stats, nil, mount.mountpoint)
+				return
+			}
+
+			direntry.forcepoll = filesystems.Polled(mount.mountpoint)
+			if direntry.forcepoll {
+				watches.Remove(direntry)
+			}
+			updateDirectory(ctx, wg, mem, exclusions, links, direntries, watches, stats, nil, newdirs, nil, direntry)
+		} else if value, known := direntries.Load(path.Dir(mount.mountpoint)); known {
+			updateDirectory(ctx, wg, mem, exclusions, links, direntries, watches, stats, nil, newdirs, nil, value.(*DirEntry))
+		}
+	}
+
+	for _, mount := range disappeared {
+		if filesystems.Unmount(mount.mountpoint) {
+			log.Println("unmounted", mount.mountpoint)
+			removeDirectory(mem, direntries, watches, stats, nil, mount.mountpoint)
+		} else {
+			changed(mount)
+		}
+	}
+
+	for _, mount := range appeared {
+		if _, known := direntries.Load(mount.mountpoint); !known && filesystems.Automount(mount) {
+			log.Println("mounted", mount.mountpoint)
+			sendDir(ctx, wg, newdirs, mount.mountpoint)
+		} else {
+			changed(mount)
+		}
+	}
+
+	return len(appeared) > 0 || len(disappeared) > 0
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	fsnotify "github.com/fsnotify/fsnotify"
+	unix "golang.org/x/sys/unix"
+
+	"testing"
+)
+
+const TEST_MOUNTINFO string = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+23 22 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:12 - proc proc rw
+24 22 8:2 / /home rw,relatime shared:2 - ext4 /dev/sda2 rw
+25 24 0:45 / /home/user/remote rw,nosuid,nodev,relatime shared:40 - fuse.sshfs user@host:/ rw,user_id=1000
+26 24 0:46 / /home/user/nfs rw,relatime shared:41 master:7 - nfs4 server:/export rw,vers=4.2
+27 24 8:2 /user/photos /home/user/photo\040album rw,relatime shared:2 - ext4 /dev/sda2 rw
+28 24 0:47 / /home/user/vault rw,nosuid,nodev,relatime - fuse.gocryptfs vault rw
+`
+
+func TestParseMountInfo(t *testing.T) {
+	mounts, err := ParseMountInfo(strings.NewReader(TEST_MOUNTINFO))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mounts) != 7 {
+		t.Fatal("expected 7 mounts, got", len(mounts))
+	}
+
+	if mounts[0].mountpoint != "/" || mounts[0].fstype != "ext4" || mounts[0].device != unix.Mkdev(8, 1) || mounts[0].parent != 1 {
+		t.Error("unexpected first mount", mounts[0])
+	}
+
+	// - optional fields before the separator don't shift fstype and source
+	if mounts[4].fstype != "nfs4" || mounts[4].source != "server:/export" {
+		t.Error("unexpected nfs mount", mounts[4])
+	}
+
+	// - escaped spaces in paths, and bind mounts show up with the root of the tree they duplicate
+	if mounts[5].mountpoint != "/home/user/photo album" || mounts[5].root != "/user/photos" || mounts[5].device != mounts[2].device {
+		t.Error("unexpected bind mount", mounts[5])
+	}
+
+	if _, err := ParseMountInfo(strings.NewReader("22 1 8:1 / / rw\n")); err == nil {
+		t.Error("parsing a line without separator should fail")
+	}
+
+	log.Println("TestParseMountInfo finished")
+}
+
+func TestReadMountInfo(t *testing.T) {
+	mounts, err := ReadMountInfo()
+	if err != nil {
+		t.Skip("no mountinfo:", err)
+	}
+
+	filesystems := NewFilesystems(Configuration{directories: []string{"/"}}, mounts)
+	if _, ok := filesystems.Mount("/"); !ok {
+		t.Error("no mount found for /")
+	}
+
+	log.Println("TestReadMountInfo finished")
+}
+
+func TestFilesystems(t *testing.T) {
+	mounts, err := ParseMountInfo(strings.NewReader(TEST_MOUNTINFO))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := Configuration{
+		directories: []string{"/", "/home/user"},
+		rootoptions: map[string]RootOptions{
+			"/":          {onefilesystem: true, skipfstypes: DEFAULT_SKIPFSTYPES},
+			"/home/user": {skipfstypes: []string{"fuse.*"}, pollfstypes: DEFAULT_POLLFSTYPES},
+		},
+	}
+	filesystems := NewFilesystems(config, mounts)
+
+	if mount, ok := filesystems.Mount("/home/user/nfs/a/b"); !ok || mount.id != 26 {
+		t.Error("unexpected mount for directory below nfs mount", mount)
+	}
+
+	for dir, expected := range map[string]bool{
+		"/":                         true,
+		"/etc":                      true,
+		"/proc":                     false,
+		"/proc/self":                false,
+		"/home":                     false, // - a different filesystem than / which is crawled with onefilesystem
+		"/home/user":                true,  // - but /home/user is a root of its own without onefilesystem
+		"/home/user/docs":           true,
+		"/home/user/remote":         false,
+		"/home/user/vault/secrets":  false,
+		"/home/user/nfs":            true,
+		"/home/user/photo album":    true,
+		"/home/user/photo album/2k": true,
+	} {
+		if filesystems.Allowed(dir) != expected {
+			t.Error("expected Allowed to be", expected, "for", dir)
+		}
+	}
+
+	for dir, expected := range map[string]bool{
+		"/":                      false,
+		"/home/user":             false,
+		"/home/user/nfs":         true,
+		"/home/user/nfs/a":       true,
+		"/home/user/photo album": false,
+		"/proc":                  false, // - / has no filesystems that are polled
+	} {
+		if filesystems.Polled(dir) != expected {
+			t.Error("expected Polled to be", expected, "for", dir)
+		}
+	}
+
+	var nilfilesystems *Filesystems
+	if !nilfilesystems.Allowed("/proc") || nilfilesystems.Polled("/home/user/nfs") {
+		t.Error("nil filesystems should allow everything and poll nothing")
+	}
+
+	log.Println("TestFilesystems finished")
+}
+
+func TestUpdateMounts(t *testing.T) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	home, media := path.Join(root, "home"), path.Join(root, "media")
+	mnt, usb := path.Join(home, "mnt"), path.Join(media, "usb")
+	for _, dir := range []string{home, media, mnt, usb, path.Join(usb, "d")} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{path.Join(usb, "1"), path.Join(usb, "d", "2")} {
+		if err := ioutil.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mem := NewResultMemory()
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	watches := NewWatches(watcher, 1024, nil)
+
+	config := Configuration{
+		directories: []string{home},
+		rootoptions: map[string]RootOptions{home: {skipfstypes: []string{"fuse.*"}}},
+		automount:   map[string]RootOptions{path.Join(media, "*"): {onefilesystem: true}},
+	}
+	base := []Mount{{id: 1, mountpoint: "/", fstype: "ext4"}}
+	filesystems := NewFilesystems(config, base)
+
+	direntries := new(sync.Map)
+	indexDirectories(t, mem, direntries, home, mnt)
+	numentries := mem.columns[SORT_BY_NAME].NumFiles()
+
+	newdirs := make(chan string, 10)
+	update := func(mounts ...Mount) bool {
+		return updateMounts(context.Background(), new(sync.WaitGroup), mem, nil, nil, direntries, watches, nil, newdirs, filesystems, append(mounts, base...))
+	}
+
+	if update() {
+		t.Error("nothing changed but updateMounts says it did")
+	}
+
+	// - a drive that is plugged in becomes a root and is crawled, we index it here like the crawler would
+	usbmount := Mount{id: 2, mountpoint: usb, fstype: "vfat"}
+	if !update(usbmount) {
+		t.Error("mounting", usb, "changed nothing")
+	}
+	if len(newdirs) != 1 || <-newdirs != usb {
+		t.Error("mounted drive", usb, "is not crawled")
+	}
+	if roots := filesystems.Roots(); len(roots) != 2 || roots[1] != usb {
+		t.Error("mounted drive", usb, "is not a root:", roots)
+	}
+	indexDirectories(t, mem, direntries, usb, path.Join(usb, "d"))
+
+	// - something we don't crawl mounted on a directory we know hides what was there before
+	fusemount := Mount{id: 3, mountpoint: mnt, fstype: "fuse.sshfs"}
+	update(usbmount, fusemount)
+	if _, known := direntries.Load(mnt); known || findEntry(mem, SORT_BY_NAME, home, "mnt") != nil {
+		t.Error("directory", mnt, "is still known after mounting a skipped filesystem on it")
+	}
+
+	// - unplugging the drive removes all of its entries, and the directory below the fuse mount is
+	// found again by updating its parent
+	update()
+	if len(newdirs) != 1 || <-newdirs != mnt {
+		t.Error("directory", mnt, "is not crawled again after unmounting")
+	}
+	if roots := filesystems.Roots(); len(roots) != 1 || roots[0] != home {
+		t.Error("unmounted drive", usb, "is still a root:", roots)
+	}
+	if _, known := direntries.Load(path.Join(usb, "d")); known {
+		t.Error("directory on unmounted drive is still known")
+	}
+	if mem.columns[SORT_BY_NAME].NumFiles() != numentries-1 {
+		t.Error("expected", numentries-1, "entries after unmounting, got", mem.columns[SORT_BY_NAME].NumFiles())
+	}
+	for _, sortcolumn := range []SortColumn{SORT_BY_NAME, SORT_BY_DIR, SORT_BY_MODTIME, SORT_BY_SIZE} {
+		if findEntry(mem, sortcolumn, usb, "1") != nil || findEntry(mem, sortcolumn, path.Join(usb, "d"), "2") != nil {
+			t.Error("file on unmounted drive still found in column", sortcolumn)
+		}
+	}
+
+	log.Println("TestUpdateMounts finished")
+}
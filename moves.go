@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// - how long a directory that vanished without being paired with a new one is remembered, the other
+// side of the move may be in a polled directory that is only polled this long after it changed
+const MOVES_TIMEOUT time.Duration = POLL_MAXINTERVAL
+
+// - moving a file or directory shows up as something vanishing in one directory and something new
+// appearing in another, inotify reports a rename and a create, polling sees two directories with a
+// new modtime, so instead of removing and adding those right away updateDirectory collects them here
+// and Apply pairs them up by device and inode once all directories of a batch of events were updated
+// - when both sides are seen in the same batch the entries are moved in place, otherwise the vanished
+// directory is removed from the index but remembered for a while, if it turns up again later we put
+// it back under its new path without crawling it again
+type Moves struct {
+	removed  []*FileEntry
+	added    []*FileEntry
+	vanished map[string]bool
+	arrived  map[string]bool
+	pending  map[inodeKey]pendingDir
+}
+
+type pendingDir struct {
+	path       string
+	direntries []*DirEntry
+	vanished   time.Time
+}
+
+type inodeKey struct {
+	device uint64
+	inode  uint64
+}
+
+func NewMoves() *Moves {
+	return &Moves{
+		vanished: make(map[string]bool),
+		arrived:  make(map[string]bool),
+		pending:  make(map[inodeKey]pendingDir),
+	}
+}
+
+// - all of these return false when moves is nil, the caller then removes or adds right away
+func (moves *Moves) Files(removed []*FileEntry, added []*FileEntry) bool {
+	if moves == nil {
+		return false
+	}
+	moves.removed = append(moves.removed, removed...)
+	moves.added = append(moves.added, added...)
+	return true
+}
+
+func (moves *Moves) Vanished(dir string) bool {
+	if moves == nil {
+		return false
+	}
+	moves.vanished[dir] = true
+	return true
+}
+
+func (moves *Moves) Arrived(dir string) bool {
+	if moves == nil {
+		return false
+	}
+	moves.arrived[dir] = true
+	return true
+}
+
+// - pairs up what vanished with what arrived, moved directories and files keep their *FileEntry, only
+// their dir and name are rewritten, everything that could not be paired is removed from mem or crawled
+// like before, returns the number of moved directories and files
+func (moves *Moves) Apply(ctx context.Context, wg *sync.WaitGroup, mem ResultMemory, exclusions *Exclusions, links *Links, direntries *sync.Map, watches *Watches, poller *Poller, stats *CrawlStats, journal *Journal, newdirs chan string, now time.Time) (int, int) {
+	if moves == nil {
+		return 0, 0
+	}
+
+	defer func() {
+		moves.removed = nil
+		moves.added = nil
+		moves.vanished = make(map[string]bool)
+		moves.arrived = make(map[string]bool)
+	}()
+
+	for key, pending := range moves.pending {
+		if now.Sub(pending.vanished) > MOVES_TIMEOUT {
+			delete(moves.pending, key)
+		}
+	}
+
+	vanished := make(map[inodeKey]*DirEntry, len(moves.vanished))
+	for dir := range moves.vanished {
+		if value, ok := direntries.Load(dir); ok && value.(*DirEntry).self != nil {
+			self := value.(*DirEntry).self
+			vanished[inodeKey{self.device, self.inode}] = value.(*DirEntry)
+		}
+	}
+
+	// - parents are handled before their children, so that a directory that arrived or vanished together
+	// with its parent is moved or remembered along with it
+	arrived := make([]string, 0, len(moves.arrived))
+	for dir := range moves.arrived {
+		arrived = append(arrived, dir)
+	}
+	sort.Strings(arrived)
+
+	unpaired := make([]string, 0, len(moves.vanished))
+	for dir := range moves.vanished {
+		unpaired = append(unpaired, dir)
+	}
+	sort.Strings(unpaired)
+
+	moveddirs := 0
+	for _, dir := range arrived {
+		if _, known := direntries.Load(dir); known {
+			continue
+		}
+
+		if len(vanished) > 0 || len(moves.pending) > 0 {
+			if dirinfo, err := os.Lstat(dir); err == nil {
+				stat := dirinfo.Sys().(*syscall.Stat_t)
+				key := inodeKey{stat.Dev, stat.Ino}
+				// - a vanished directory that was already moved along with its parent has a new path
+				if direntry, ok := vanished[key]; ok && moves.vanished[direntry.path] {
+					delete(vanished, key)
+					journal.Record(CHANGE_RENAMED, dir, direntry.path, true)
+					moveDirectory(mem, direntries, watches, stats, direntry.path, dir)
+					moveddirs += 1
+					continue
+				}
+
+				if pending, ok := moves.pending[key]; ok {
+					delete(moves.pending, key)
+					journal.Record(CHANGE_RENAMED, dir, pending.path, true)
+					restoreDirectory(ctx, wg, mem, exclusions, links, direntries, watches, poller, stats, journal, newdirs, pending, dir, now)
+					moveddirs += 1
+					continue
+				}
+			}
+		}
+
+		journal.Created(dir)
+		sendDir(ctx, wg, newdirs, dir)
+	}
+
+	for _, dir := range unpaired {
+		value, known := direntries.Load(dir)
+		if !known {
+			continue
+		}
+
+		if self := value.(*DirEntry).self; self != nil {
+			pending := pendingDir{path: dir, vanished: now}
+			direntries.Range(func(key, value interface{}) bool {
+				if subdir := key.(string); subdir == dir || strings.HasPrefix(subdir, dir+"/") {
+					pending.direntries = append(pending.direntries, value.(*DirEntry))
+				}
+				return true
+			})
+			moves.pending[inodeKey{self.device, self.inode}] = pending
+		}
+		removeDirectory(mem, direntries, watches, stats, journal, dir)
+	}
+
+	// - a file that changed in place is removed and added under the same path, those are not moves, and a
+	// file that was changed while it was moved is replaced like any other changed file
+	removed := make(map[inodeKey]*FileEntry, len(moves.removed))
+	for _, entry := range moves.removed {
+		removed[inodeKey{entry.device, entry.inode}] = entry
+	}
+
+	paired := make(map[*FileEntry]bool)
+	var renamed, renamedto, unpairedadded []*FileEntry
+	for _, entry := range moves.added {
+		key := inodeKey{entry.device, entry.inode}
+		oldentry, ok := removed[key]
+		if ok && (oldentry.Dir() != entry.Dir() || oldentry.name != entry.name) &&
+			oldentry.size == entry.size && oldentry.modtime.Equal(entry.modtime) && oldentry.mode == entry.mode {
+			delete(removed, key)
+			paired[oldentry] = true
+			renamed = append(renamed, oldentry)
+			renamedto = append(renamedto, entry)
+		} else {
+			unpairedadded = append(unpairedadded, entry)
+		}
+	}
+
+	var unpairedremoved []*FileEntry
+	for _, entry := range moves.removed {
+		if !paired[entry] {
+			unpairedremoved = append(unpairedremoved, entry)
+		}
+	}
+
+	for i, entry := range renamed {
+		journal.Record(CHANGE_RENAMED, path.Join(renamedto[i].Dir(), renamedto[i].name), path.Join(entry.Dir(), entry.name), false)
+	}
+
+	// - nlink is not part of any ordering, it is updated first so that renameFiles knows about files that
+	// were hard linked since they were read
+	for i, entry := range renamed {
+		entry.nlink = renamedto[i].nlink
+	}
+	renameFiles(mem, renamed, func() {
+		for i, entry := range renamed {
+			entry.direntry = renamedto[i].direntry
+			entry.name = renamedto[i].name
+
+			// - the directory the file was moved to has the new entry in its files, we put the old entry
+			// back in its place because that is the one that is in the buckets
+			files := entry.direntry.files
+			for j := range files {
+				if files[j] == renamedto[i] {
+					files[j] = entry
+				}
+			}
+		}
+	})
+
+	removeFiles(mem, unpairedremoved)
+	mergeFiles(mem, unpairedadded)
+	journal.Diff(unpairedremoved, unpairedadded)
+
+	return moveddirs, len(renamed)
+}
+
+// - only the columns whose key is made from the path of entries change when files are moved, so we remove
+// the files from those, let rename change them, and merge them back in, the other columns compare entries
+// with equal keys by their inode and keep the same entries in the same places
+// - hard linked files share their inode with other entries, which are compared by their path in every
+// column, so those are moved in the other columns too, a directory can not be hard linked
+func renameFiles(mem ResultMemory, files []*FileEntry, rename func()) {
+	if len(files) == 0 {
+		return
+	}
+
+	var hardlinked []*FileEntry
+	for _, entry := range files {
+		if !entry.IsDir() && entry.nlink > 1 {
+			hardlinked = append(hardlinked, entry)
+		}
+	}
+
+	// - the files of every column, sorted by it
+	columns := make([][]*FileEntry, len(mem.columns))
+	for i := range mem.columns {
+		sortcolumn := SortColumn(i)
+		if orderings[sortcolumn].pathkey {
+			columns[i] = append([]*FileEntry(nil), files...)
+		} else {
+			columns[i] = append([]*FileEntry(nil), hardlinked...)
+		}
+		if len(columns[i]) > 0 {
+			sortFileEntries(sortcolumn, columns[i])
+			mem.Column(sortcolumn).Remove(sortcolumn, columns[i])
+		}
+	}
+
+	rename()
+
+	for i := range mem.columns {
+		sortcolumn := SortColumn(i)
+		if len(columns[i]) > 0 {
+			sortFileEntries(sortcolumn, columns[i])
+			mem.Column(sortcolumn).Merge(sortcolumn, columns[i])
+		}
+	}
+}
+
+// - moves the directory olddir and all directories below it to newdir, the files and rows of the
+// directories are rewritten in place and watched directories are watched under their new path
+func moveDirectory(mem ResultMemory, direntries *sync.Map, watches *Watches, stats *CrawlStats, olddir string, newdir string) {
+	var moved []*DirEntry
+	var files []*FileEntry
+	direntries.Range(func(key, value interface{}) bool {
+		subdir := key.(string)
+		if subdir == olddir || strings.HasPrefix(subdir, olddir+"/") {
+			direntry := value.(*DirEntry)
+			moved = append(moved, direntry)
+			files = append(files, direntry.files...)
+			if direntry.self != nil {
+				files = append(files, direntry.self)
+			}
+		}
+		return true
+	})
+
+	renameFiles(mem, files, func() {
+		for _, direntry := range moved {
+			watched := direntry.inotify
+			watches.Remove(direntry)
+			direntries.Delete(direntry.path)
+			stats.Clear(direntry.path)
+
+			rewritePath(direntry, olddir, newdir)
+
+			direntries.Store(direntry.path, direntry)
+			if watched {
+				watches.Add(direntry)
+			}
+		}
+	})
+}
+
+// - the entries of direntry get their dir from it, only the name of the row of the directory itself has
+// to be changed
+func rewritePath(direntry *DirEntry, olddir string, newdir string) {
+	direntry.path = newdir + strings.TrimPrefix(direntry.path, olddir)
+	if direntry.self != nil {
+		direntry.self.name = path.Base(direntry.path)
+	}
+}
+
+// - puts a directory that vanished in an earlier batch back under its new path, its entries were removed
+// from mem already so they are merged into all columns again, but nothing is read from disk except for
+// directories that changed while they were gone, which are updated like after loading the index
+func restoreDirectory(ctx context.Context, wg *sync.WaitGroup, mem ResultMemory, exclusions *Exclusions, links *Links, direntries *sync.Map, watches *Watches, poller *Poller, stats *CrawlStats, journal *Journal, newdirs chan string, pending pendingDir, newdir string, now time.Time) {
+	var files []*FileEntry
+	for _, direntry := range pending.direntries {
+		rewritePath(direntry, pending.path, newdir)
+		direntries.Store(direntry.path, direntry)
+		poller.Add(direntry, now)
+
+		stats.Indexed(direntry.files)
+		files = append(files, direntry.files...)
+		if direntry.self != nil {
+			files = append(files, direntry.self)
+		}
+	}
+	stats.Directories(len(pending.direntries))
+	mergeFiles(mem, files)
+
+	for _, direntry := range pending.direntries {
+		if dirinfo, err := os.Lstat(direntry.path); err != nil || !dirinfo.ModTime().Equal(direntry.modtime) {
+			updateDirectory(ctx, wg, mem, exclusions, links, direntries, watches, stats, journal, newdirs, nil, direntry)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"runtime"
+	"sync"
+	"time"
+
+	fsnotify "github.com/fsnotify/fsnotify"
+
+	"testing"
+)
+
+func indexDirectories(t *testing.T, mem ResultMemory, direntries *sync.Map, dirs ...string) {
+	for _, dir := range dirs {
+		direntry := &DirEntry{path: dir}
+		dirinfo, fileentries, _, err := readDir(nil, nil, nil, direntry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		direntry.modtime, direntry.files, direntry.self = dirinfo.ModTime(), fileentries, newDirFileEntry(direntry, dirinfo)
+		direntries.Store(dir, direntry)
+		mergeFiles(mem, append(fileentries, direntry.self))
+	}
+}
+
+// - records what is merged into and removed from a column
+type recordingResult struct {
+	CrawlResult
+	changed map[*FileEntry]bool
+}
+
+func (result *recordingResult) Merge(sortcolumn SortColumn, files []*FileEntry) {
+	for _, entry := range files {
+		result.changed[entry] = true
+	}
+	result.CrawlResult.Merge(sortcolumn, files)
+}
+
+func (result *recordingResult) Remove(sortcolumn SortColumn, files []*FileEntry) {
+	for _, entry := range files {
+		result.changed[entry] = true
+	}
+	result.CrawlResult.Remove(sortcolumn, files)
+}
+
+func findEntry(mem ResultMemory, sortcolumn SortColumn, dir string, name string) *FileEntry {
+	for _, entry := range takeAll(mem.Column(sortcolumn), sortcolumn, DEFAULT_DIRECTION, nil, 1000) {
+		if entry.Dir() == dir && entry.name == name {
+			return entry
+		}
+	}
+	return nil
+}
+
+func TestMoveFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	a, b := path.Join(root, "a"), path.Join(root, "b")
+	for _, dir := range []string{a, b} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"1", "2", "3"} {
+		if err := ioutil.WriteFile(path.Join(a, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mem := NewResultMemory()
+	direntries := new(sync.Map)
+	indexDirectories(t, mem, direntries, root, a, b)
+	numentries := mem.columns[SORT_BY_NAME].NumFiles()
+
+	moved := findEntry(mem, SORT_BY_NAME, a, "1")
+	renamed := findEntry(mem, SORT_BY_NAME, a, "2")
+	if err := os.Rename(path.Join(a, "1"), path.Join(b, "1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path.Join(a, "2"), path.Join(a, "4")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path.Join(a, "3")); err != nil {
+		t.Fatal(err)
+	}
+
+	bymodtime := &recordingResult{mem.columns[SORT_BY_MODTIME], make(map[*FileEntry]bool)}
+	bysize := &recordingResult{mem.columns[SORT_BY_SIZE], make(map[*FileEntry]bool)}
+	mem.columns[SORT_BY_MODTIME], mem.columns[SORT_BY_SIZE] = bymodtime, bysize
+
+	moves := NewMoves()
+	newdirs := make(chan string, 10)
+	for _, dir := range []string{a, b} {
+		value, _ := direntries.Load(dir)
+		updateDirectory(context.Background(), new(sync.WaitGroup), mem, nil, nil, direntries, nil, nil, nil, newdirs, moves, value.(*DirEntry))
+	}
+	moveddirs, movedfiles := moves.Apply(context.Background(), new(sync.WaitGroup), mem, nil, nil, direntries, nil, NewPoller(0), nil, nil, newdirs, time.Now())
+
+	if moveddirs != 0 || movedfiles != 2 {
+		t.Error("expected 2 moved files, got", moveddirs, movedfiles)
+	}
+	if moved.Dir() != b || moved.name != "1" || renamed.Dir() != a || renamed.name != "4" {
+		t.Error("moved files were not rewritten in place:", moved.Dir(), moved.name, renamed.Dir(), renamed.name)
+	}
+
+	// - the removed file is gone, the moved ones are found under their new path in every column, without
+	// being touched in the modtime and size columns
+	if mem.columns[SORT_BY_NAME].NumFiles() != numentries-1 {
+		t.Error("expected", numentries-1, "entries, got", mem.columns[SORT_BY_NAME].NumFiles())
+	}
+	for _, sortcolumn := range []SortColumn{SORT_BY_NAME, SORT_BY_DIR, SORT_BY_MODTIME, SORT_BY_SIZE} {
+		if findEntry(mem, sortcolumn, b, "1") != moved || findEntry(mem, sortcolumn, a, "4") != renamed || findEntry(mem, sortcolumn, a, "3") != nil {
+			t.Error("unexpected entries in column", sortcolumn, "after move")
+		}
+	}
+	if bymodtime.changed[moved] || bymodtime.changed[renamed] || bysize.changed[moved] || bysize.changed[renamed] {
+		t.Error("moved files were removed from or merged into the modtime and size columns")
+	}
+
+	value, _ := direntries.Load(b)
+	if files := value.(*DirEntry).files; len(files) != 1 || files[0] != moved {
+		t.Error("expected the moved entry in the files of", b, "got", files)
+	}
+
+	log.Println("TestMoveFiles finished")
+}
+
+// - files with the same modtime and size are ordered by their inode in those columns, so a rename leaves
+// them alone, unless the file is hard linked and shares its inode with another entry, then the entries
+// are ordered by their path, and the rename must be seen by the modtime and size columns, or the file
+// can't be removed later
+func TestRenameEqualKeys(t *testing.T) {
+	mem := NewResultMemory()
+	bymodtime := &recordingResult{mem.columns[SORT_BY_MODTIME], make(map[*FileEntry]bool)}
+	bysize := &recordingResult{mem.columns[SORT_BY_SIZE], make(map[*FileEntry]bool)}
+	mem.columns[SORT_BY_MODTIME], mem.columns[SORT_BY_SIZE] = bymodtime, bysize
+
+	direntry := &DirEntry{path: "/x"}
+	modtime := time.Now()
+	var files []*FileEntry
+	for i, name := range []string{"a", "b", "c", "e", "f"} {
+		entry := &FileEntry{direntry: direntry, name: name, modtime: modtime, size: 1, inode: uint64(i + 1), nlink: 1}
+		if name == "e" || name == "f" {
+			entry.inode, entry.nlink = 4, 2
+		}
+		files = append(files, entry)
+	}
+	mergeFiles(mem, files)
+	// - taking entries sorts them, otherwise they would still be in the queue where Remove looks at all of them
+	for i := range mem.columns {
+		takeAll(mem.Column(SortColumn(i)), SortColumn(i), DEFAULT_DIRECTION, nil, 10)
+	}
+
+	renamed, hardlinked := files[0], files[3]
+	bymodtime.changed, bysize.changed = make(map[*FileEntry]bool), make(map[*FileEntry]bool)
+	renameFiles(mem, []*FileEntry{renamed, hardlinked}, func() {
+		renamed.name = "d"
+		hardlinked.name = "g"
+	})
+	if bymodtime.changed[renamed] || bysize.changed[renamed] {
+		t.Error("renamed file was moved in the modtime and size columns")
+	}
+	if !bymodtime.changed[hardlinked] || !bysize.changed[hardlinked] {
+		t.Error("hard linked file was not moved in the modtime and size columns")
+	}
+
+	removeFiles(mem, []*FileEntry{renamed, hardlinked})
+	for i := range mem.columns {
+		sortcolumn := SortColumn(i)
+		entries := takeAll(mem.Column(sortcolumn), sortcolumn, DEFAULT_DIRECTION, nil, 10)
+		if len(entries) != 3 || mem.Column(sortcolumn).NumFiles() != 3 {
+			t.Error("renamed files were not removed from column", sortcolumn, "got", len(entries), "entries")
+		}
+		for _, entry := range entries {
+			if entry == renamed || entry == hardlinked {
+				t.Error("renamed file", entry.name, "is still in column", sortcolumn)
+			}
+		}
+	}
+
+	log.Println("TestRenameEqualKeys finished")
+}
+
+func TestMoveDirectory(t *testing.T) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	a, b := path.Join(root, "a"), path.Join(root, "b")
+	x, y := path.Join(a, "x"), path.Join(a, "x", "y")
+	for _, dir := range []string{a, b, x, y} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{path.Join(x, "1"), path.Join(y, "2")} {
+		if err := ioutil.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mem := NewResultMemory()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	watches := NewWatches(watcher, 1024, nil)
+
+	direntries := new(sync.Map)
+	indexDirectories(t, mem, direntries, root, a, b, x, y)
+	for _, dir := range []string{x, y} {
+		value, _ := direntries.Load(dir)
+		watches.Add(value.(*DirEntry))
+	}
+	numentries := mem.columns[SORT_BY_NAME].NumFiles()
+	file := findEntry(mem, SORT_BY_NAME, y, "2")
+
+	z := path.Join(b, "z")
+	if err := os.Rename(x, z); err != nil {
+		t.Fatal(err)
+	}
+
+	// - this is what the crawler sees from inotify, a rename of x and changes in a and b
+	moves := NewMoves()
+	moves.Vanished(x)
+	newdirs := make(chan string, 10)
+	for _, dir := range []string{a, b} {
+		value, _ := direntries.Load(dir)
+		updateDirectory(context.Background(), new(sync.WaitGroup), mem, nil, nil, direntries, watches, nil, nil, newdirs, moves, value.(*DirEntry))
+	}
+	moveddirs, _ := moves.Apply(context.Background(), new(sync.WaitGroup), mem, nil, nil, direntries, watches, NewPoller(0), nil, nil, newdirs, time.Now())
+
+	if moveddirs != 1 {
+		t.Error("expected 1 moved directory, got", moveddirs)
+	}
+	if len(newdirs) != 0 {
+		t.Error("moved directory is crawled again:", <-newdirs)
+	}
+
+	for _, dir := range []string{x, y} {
+		if _, known := direntries.Load(dir); known {
+			t.Error("old directory", dir, "is still known")
+		}
+	}
+	for _, dir := range []string{z, path.Join(z, "y")} {
+		value, known := direntries.Load(dir)
+		if !known {
+			t.Error("moved directory", dir, "is not known")
+			continue
+		}
+		if direntry := value.(*DirEntry); !direntry.inotify || direntry.self.Dir() != path.Dir(dir) || direntry.self.name != path.Base(dir) {
+			t.Error("moved directory", dir, "is not watched or has a wrong row:", direntry.inotify, direntry.self.Dir(), direntry.self.name)
+		}
+	}
+
+	if mem.columns[SORT_BY_NAME].NumFiles() != numentries {
+		t.Error("expected", numentries, "entries, got", mem.columns[SORT_BY_NAME].NumFiles())
+	}
+	for _, sortcolumn := range []SortColumn{SORT_BY_NAME, SORT_BY_DIR, SORT_BY_MODTIME, SORT_BY_SIZE} {
+		if findEntry(mem, sortcolumn, path.Join(z, "y"), "2") != file || findEntry(mem, sortcolumn, b, "z") == nil || findEntry(mem, sortcolumn, a, "x") != nil {
+			t.Error("unexpected entries in column", sortcolumn, "after move")
+		}
+	}
+
+	log.Println("TestMoveDirectory finished")
+}
+
+func TestRestoreDirectory(t *testing.T) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	a, b := path.Join(root, "a"), path.Join(root, "b")
+	x, y := path.Join(a, "x"), path.Join(a, "x", "y")
+	for _, dir := range []string{a, b, x, y} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(path.Join(y, "1"), []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mem := NewResultMemory()
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	watches := NewWatches(watcher, 1024, nil)
+
+	direntries := new(sync.Map)
+	indexDirectories(t, mem, direntries, root, a, b, x, y)
+	numentries := mem.columns[SORT_BY_NAME].NumFiles()
+	file := findEntry(mem, SORT_BY_NAME, y, "1")
+
+	z := path.Join(b, "z")
+	if err := os.Rename(x, z); err != nil {
+		t.Fatal(err)
+	}
+
+	// - a is watched and notices the move right away, b is polled and only notices it in a later batch,
+	// x and y vanish and are removed in between
+	moves := NewMoves()
+	newdirs := make(chan string, 10)
+	update := func(dir string) {
+		value, _ := direntries.Load(dir)
+		updateDirectory(context.Background(), new(sync.WaitGroup), mem, nil, nil, direntries, watches, nil, nil, newdirs, moves, value.(*DirEntry))
+		moves.Apply(context.Background(), new(sync.WaitGroup), mem, nil, nil, direntries, watches, NewPoller(0), nil, nil, newdirs, time.Now())
+	}
+
+	update(a)
+	if _, known := direntries.Load(y); known || findEntry(mem, SORT_BY_NAME, y, "1") != nil {
+		t.Error("vanished directory", y, "is still known")
+	}
+
+	update(b)
+	if len(newdirs) != 0 {
+		t.Error("moved directory is crawled again:", <-newdirs)
+	}
+	if _, known := direntries.Load(path.Join(z, "y")); !known {
+		t.Error("moved directory", path.Join(z, "y"), "was not restored")
+	}
+	if mem.columns[SORT_BY_NAME].NumFiles() != numentries {
+		t.Error("expected", numentries, "entries, got", mem.columns[SORT_BY_NAME].NumFiles())
+	}
+	for _, sortcolumn := range []SortColumn{SORT_BY_NAME, SORT_BY_DIR, SORT_BY_MODTIME, SORT_BY_SIZE} {
+		if findEntry(mem, sortcolumn, path.Join(z, "y"), "1") != file {
+			t.Error("restored file not found in column", sortcolumn)
+		}
+	}
+
+	log.Println("TestRestoreDirectory finished")
+}
+
+func TestCrawlerMove(t *testing.T) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	a, b := path.Join(root, "a"), path.Join(root, "b")
+	for _, dir := range []string{a, b, path.Join(a, "x")} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(path.Join(a, "x", "1"), []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mem := NewResultMemory()
+	config := Configuration{
+		cores:       runtime.NumCPU(),
+		directories: []string{root},
+		maxinotify:  1024,
+	}
+
+	crawler := startCrawler(testCrawler{mem: mem, config: config})
+	defer crawler.stop()
+
+	file := findEntry(mem, SORT_BY_NAME, path.Join(a, "x"), "1")
+	if file == nil {
+		t.Fatal("crawler did not find", path.Join(a, "x", "1"))
+	}
+	if err := os.Rename(path.Join(a, "x"), path.Join(b, "y")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if moved := findEntry(mem, SORT_BY_NAME, path.Join(b, "y"), "1"); moved != nil {
+			if moved != file {
+				t.Error("moved file was crawled again instead of being moved")
+			}
+			log.Println("TestCrawlerMove finished")
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Error("crawler did not notice that", path.Join(a, "x"), "was moved")
+}
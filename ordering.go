@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+type SortColumn int
+
+// - every column has an entry in orderings below, the value of a SortColumn is its index in orderings,
+// in ResultMemory and in the list store of the view
+const (
+	SORT_BY_NAME SortColumn = iota
+	SORT_BY_DIR
+	SORT_BY_MODTIME
+	SORT_BY_SIZE
+	SORT_BY_EXTENSION
+)
+
+// - a threshold is the key of an entry in the ordering of its bucket, a node contains the entries that
+// are less then its threshold, a nil threshold is greater then everything
+// - thresholds that were made while splitting a bucket are a *FileEntry instead of a key, so that a run of
+// entries with equal keys can still be split up by the rest of the ordering
+type Threshold interface{}
+
+// - everything that buckets, sorting and the view need to know about an order of entries, a new index is
+// added by adding a SortColumn and an Ordering for it to orderings, the functions that work on keys are
+// only ever called with keys that were made by key or thresholds of the same ordering
+// - entries with equal keys are compared by the keys of the columns in ties, and then by their path, so
+// that every ordering is total and entries don't change places between updates, less is made from these
+// in init, lesskey and lessfield only compare the key of the ordering itself
+// - pathkey is set when the key is made from the path of entries, orderings whose key is not compare the
+// device and inode of entries with equal keys before their path, a rename does not change those, so that
+// renamed entries keep their place in them and renameFiles can leave their columns alone
+// - thresholds are made for a point in time, orderings whose thresholds depend on it are moved along
+// with the clock by Roll
+type Ordering struct {
+	title      string
+	width      int
+	ties       []SortColumn
+	pathkey    bool
+	text       func(entry *FileEntry) string
+	less       func(a, b *FileEntry) bool
+	lessfield  func(a, b *FileEntry) bool
+	key        func(entry *FileEntry) Threshold
+	lesskey    func(a, b Threshold) bool
+	format     func(key Threshold) string
+	thresholds func(now time.Time) []Threshold
+}
+
+// - builds an Ordering from a key extractor and a comparator for keys, the entries are compared by their
+// keys directly, so that sorting and inserting into buckets does not box a key for every comparison
+func newOrdering[K any](title string, width int, ties []SortColumn, pathkey bool, text func(entry *FileEntry) string, key func(entry *FileEntry) K, less func(a, b K) bool, format func(key K) string, thresholds func(now time.Time) []K) Ordering {
+	return Ordering{
+		title:   title,
+		width:   width,
+		ties:    ties,
+		pathkey: pathkey,
+		text:    text,
+		lessfield: func(a, b *FileEntry) bool {
+			return less(key(a), key(b))
+		},
+		key: func(entry *FileEntry) Threshold {
+			return key(entry)
+		},
+		lesskey: func(a, b Threshold) bool {
+			return less(a.(K), b.(K))
+		},
+		format: func(threshold Threshold) string {
+			return format(threshold.(K))
+		},
+		thresholds: func(now time.Time) []Threshold {
+			var result []Threshold
+			for _, threshold := range thresholds(now) {
+				result = append(result, threshold)
+			}
+			return result
+		},
+	}
+}
+
+func lessPath(a, b *FileEntry) bool {
+	adir, bdir := a.Dir(), b.Dir()
+	if adir != bdir {
+		return adir < bdir
+	}
+	return a.name < b.name
+}
+
+func lessInode(a, b *FileEntry) bool {
+	if a.device != b.device {
+		return a.device < b.device
+	}
+	return a.inode < b.inode
+}
+
+// - the threshold that ThresholdSplit makes from entry, it is a copy of the fields that the orderings
+// look at, so that renaming or updating entry later does not move the boundary between two nodes
+func entryThreshold(entry *FileEntry) Threshold {
+	return &FileEntry{direntry: &DirEntry{path: entry.Dir()}, name: entry.name, modtime: entry.modtime, size: entry.size, mode: entry.mode, inode: entry.inode, device: entry.device}
+}
+
+func (ordering *Ordering) Below(entry *FileEntry, threshold Threshold) bool {
+	switch threshold := threshold.(type) {
+	case nil:
+		return true
+	case *FileEntry:
+		return ordering.less(entry, threshold)
+	default:
+		return ordering.lesskey(ordering.key(entry), threshold)
+	}
+}
+
+// - a key stands for all entries with that key, so it is less then an entry threshold with an equal key
+func (ordering *Ordering) LessThreshold(a, b Threshold) bool {
+	if a == nil || b == nil {
+		return a != nil
+	}
+
+	entrya, isentrya := a.(*FileEntry)
+	entryb, isentryb := b.(*FileEntry)
+	if isentrya && isentryb {
+		return ordering.less(entrya, entryb)
+	}
+	if isentrya {
+		a = ordering.key(entrya)
+	}
+	if isentryb {
+		b = ordering.key(entryb)
+	}
+	if ordering.lesskey(a, b) {
+		return true
+	}
+	return !ordering.lesskey(b, a) && !isentrya && isentryb
+}
+
+func (ordering *Ordering) Equal(a, b Threshold) bool {
+	return !ordering.LessThreshold(a, b) && !ordering.LessThreshold(b, a)
+}
+
+func (ordering *Ordering) Format(threshold Threshold) string {
+	switch threshold := threshold.(type) {
+	case nil:
+		return "maximum"
+	case *FileEntry:
+		return ordering.format(ordering.key(threshold)) + " " + path.Join(threshold.Dir(), threshold.name)
+	default:
+		return ordering.format(threshold)
+	}
+}
+
+var orderings = []Ordering{
+	SORT_BY_NAME: newOrdering("Name", 500, nil, true,
+		func(entry *FileEntry) string {
+			if entry.IsDir() {
+				return entry.name + "/"
+			}
+			return entry.name
+		},
+		func(entry *FileEntry) string { return entry.name },
+		func(a, b string) bool { return a < b },
+		func(name string) string { return name },
+		func(_ time.Time) []string {
+			var thresholds []string
+			for _, char := range "@abcdefghijklmnopqrstuvwxyz" {
+				thresholds = append(thresholds, string(char))
+			}
+			return thresholds
+		}),
+	SORT_BY_DIR: newOrdering("Dir", 800, nil, true,
+		func(entry *FileEntry) string { return entry.Dir() },
+		func(entry *FileEntry) string { return entry.Dir() },
+		func(a, b string) bool { return a[1:] < b[1:] },
+		func(dir string) string { return dir },
+		func(_ time.Time) []string { return nil }),
+	SORT_BY_MODTIME: newOrdering("Modification Time", 200, nil, false,
+		func(entry *FileEntry) string { return entry.modtime.Format("2006-01-02 15:04:05") },
+		func(entry *FileEntry) time.Time { return entry.modtime },
+		func(a, b time.Time) bool { return a.After(b) },
+		func(modtime time.Time) string { return modtime.Format("2006-01-02 15:04:05") },
+		func(now time.Time) []time.Time {
+			day := time.Hour * 24
+			week := day * 7
+			year := week * 52
+			return []time.Time{now, now.Add(-time.Hour), now.Add(-day), now.Add(-week), now.Add(-week * 4), now.Add(-year), now.Add(-year * 10)}
+		}),
+	SORT_BY_SIZE: newOrdering("Size", 120, nil, false,
+		// - directories are shown with the size of everything below them, which stays empty until it has
+		// been summed up
+		func(entry *FileEntry) string {
+			if entry.IsDir() {
+				if recursivesize := entry.RecursiveSize(); recursivesize > 0 {
+					return formatSize(recursivesize)
+				}
+				return ""
+			}
+			return formatSize(entry.size)
+		},
+		func(entry *FileEntry) int64 { return entry.size },
+		func(a, b int64) bool { return a > b },
+		formatSize,
+		// <4097 are very popular file sizes
+		func(_ time.Time) []int64 {
+			return []int64{100000000, 10000000, 1000000, 100000, 10000, 4097, 1000, 100, 1}
+		}),
+	// - like names, extensions are split up by their first letter, the first child gets files without an
+	// extension together with everything that starts with a digit or punctuation
+	// - files with the same extension are shown biggest first
+	SORT_BY_EXTENSION: newOrdering("Extension", 100, []SortColumn{SORT_BY_SIZE}, true,
+		func(entry *FileEntry) string { return extension(entry.name) },
+		func(entry *FileEntry) string { return extension(entry.name) },
+		lessFold,
+		func(ext string) string { return "." + ext },
+		func(_ time.Time) []string {
+			var thresholds []string
+			for _, char := range "0abcdefghijklmnopqrstuvwxyz" {
+				thresholds = append(thresholds, string(char))
+			}
+			return thresholds
+		}),
+}
+
+// - less can only be made once orderings exists, because it looks up the orderings of the ties
+func init() {
+	for i := range orderings {
+		fields := []func(a, b *FileEntry) bool{orderings[i].lessfield}
+		for _, tie := range orderings[i].ties {
+			fields = append(fields, orderings[tie].lessfield)
+		}
+
+		byinode := !orderings[i].pathkey
+		orderings[i].less = func(a, b *FileEntry) bool {
+			for _, less := range fields {
+				if less(a, b) {
+					return true
+				}
+				if less(b, a) {
+					return false
+				}
+			}
+			if byinode && (a.device != b.device || a.inode != b.inode) {
+				return lessInode(a, b)
+			}
+			return lessPath(a, b)
+		}
+	}
+}
+
+func formatSize(size int64) string {
+	if size >= (1000 * 1000 * 1000 * 1000 * 1000) {
+		return fmt.Sprintf("%.3fP", float64(size)/(1000*1000*1000*1000*1000))
+	} else if size >= (1000 * 1000 * 1000 * 1000) {
+		return fmt.Sprintf("%.3fT", float64(size)/(1000*1000*1000*1000))
+	} else if size >= (1000 * 1000 * 1000) {
+		return fmt.Sprintf("%.3fG", float64(size)/(1000*1000*1000))
+	} else if size >= (1000 * 1000) {
+		return fmt.Sprintf("%.3fM", float64(size)/(1000*1000))
+	} else if size >= 1000 {
+		return fmt.Sprintf("%.3fK", float64(size)/1000)
+	} else {
+		return fmt.Sprintf("%db", size)
+	}
+}
+
+// - the extension of name without the dot, a name that starts with its only dot, like .bashrc, has no
+// extension
+func extension(name string) string {
+	i := strings.LastIndexByte(name, '.')
+	if i <= 0 {
+		return ""
+	}
+	return name[i+1:]
+}
+
+// - compares ascii letters without case, so that .ISO and .iso end up next to each other, it is used
+// while sorting, so it must not allocate like strings.ToLower would
+func lessFold(a, b string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, y := a[i], b[i]
+		if 'A' <= x && x <= 'Z' {
+			x += 'a' - 'A'
+		}
+		if 'A' <= y && y <= 'Z' {
+			y += 'a' - 'A'
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"testing"
+)
+
+func TestOrderings(t *testing.T) {
+	if len(orderings) != int(SORT_BY_EXTENSION)+1 {
+		t.Fatal("expected an ordering for every sort column, got", len(orderings))
+	}
+
+	entry := &FileEntry{direntry: &DirEntry{path: "/x"}, name: "a.iso", modtime: time.Now(), size: 1}
+	for i := range orderings {
+		ordering := &orderings[i]
+		if ordering.title == "" || ordering.width <= 0 {
+			t.Error("ordering", i, "has no title or width")
+		}
+
+		// - the children of a bucket are made from these, so they have to be ascending
+		thresholds := ordering.thresholds(time.Now())
+		for j := 1; j < len(thresholds); j++ {
+			if !ordering.lesskey(thresholds[j-1], thresholds[j]) {
+				t.Error("thresholds of", ordering.title, "are not ascending at", ordering.Format(thresholds[j]))
+			}
+		}
+
+		bucket := NewBucket(SortColumn(i), NewEntryTable())
+		if len(bucket.children) != len(thresholds)+1 || bucket.children[len(thresholds)].Node().threshold != nil {
+			t.Error("bucket of", ordering.title, "does not have a child for every threshold and one for the maximum")
+		}
+
+		if !ordering.Below(entry, nil) || !ordering.Equal(nil, nil) || ordering.Equal(ordering.key(entry), nil) {
+			t.Error("nil is not the maximum threshold of", ordering.title)
+		}
+		if !ordering.Equal(ordering.key(entry), ordering.key(entry)) || ordering.Below(entry, ordering.key(entry)) {
+			t.Error("key of an entry is not equal to itself in", ordering.title)
+		}
+	}
+
+	if orderings[SORT_BY_NAME].text(&FileEntry{name: "dir", mode: os.ModeDir}) != "dir/" {
+		t.Error("directories should be shown with a trailing slash")
+	}
+
+	for size, text := range map[int64]string{999: "999b", 1000: "1.000K", 1500000: "1.500M", 2000000000000: "2.000T"} {
+		if formatSize(size) != text {
+			t.Error("formatSize of", size, "is", formatSize(size), "expected", text)
+		}
+	}
+
+	for name, ext := range map[string]string{"a.tar.gz": "gz", ".bashrc": "", "Makefile": "", "x.": "", "CD.ISO": "ISO"} {
+		if extension(name) != ext {
+			t.Error("extension of", name, "is", extension(name), "expected", ext)
+		}
+	}
+	if !lessFold("ISO", "jpg") || lessFold("iso", "ISO") || lessFold("ISO", "iso") || !lessFold("", "a") {
+		t.Error("lessFold does not compare without case")
+	}
+
+	// - equal keys are compared by the ties and then by path
+	a := &FileEntry{direntry: &DirEntry{path: "/b"}, name: "x.iso", modtime: time.Now(), size: 10}
+	b := &FileEntry{direntry: &DirEntry{path: "/a"}, name: "y.ISO", modtime: a.modtime, size: 20}
+	c := &FileEntry{direntry: &DirEntry{path: "/a"}, name: "z.iso", modtime: a.modtime, size: 20}
+	if !lessFileEntries(SORT_BY_SIZE, b, c) || !lessFileEntries(SORT_BY_MODTIME, b, a) || lessFileEntries(SORT_BY_MODTIME, a, a) {
+		t.Error("entries with equal keys are not ordered by path")
+	}
+	if !lessFileEntries(SORT_BY_EXTENSION, b, a) || !lessFileEntries(SORT_BY_EXTENSION, b, c) {
+		t.Error("entries with equal extensions are not ordered by size and then path")
+	}
+
+	// - modtime and size compare the inode before the path, so that renamed entries keep their place, the
+	// key of extensions is made from the path, so they don't
+	d := &FileEntry{direntry: &DirEntry{path: "/a"}, name: "d", modtime: a.modtime, size: 20, inode: 2}
+	e := &FileEntry{direntry: &DirEntry{path: "/b"}, name: "e", modtime: a.modtime, size: 20, inode: 1}
+	if !lessFileEntries(SORT_BY_MODTIME, e, d) || !lessFileEntries(SORT_BY_SIZE, e, d) || !lessFileEntries(SORT_BY_EXTENSION, d, e) {
+		t.Error("entries with equal keys are not ordered by inode before path")
+	}
+
+	// - a key is less then an entry threshold with the same key, but not less then an entry with a bigger key
+	size := &orderings[SORT_BY_SIZE]
+	if !size.LessThreshold(int64(20), entryThreshold(b)) || size.LessThreshold(entryThreshold(b), int64(20)) ||
+		size.LessThreshold(int64(10), entryThreshold(b)) || !size.LessThreshold(entryThreshold(b), entryThreshold(c)) {
+		t.Error("unexpected order of key and entry thresholds")
+	}
+	if !size.Below(c, entryThreshold(a)) || size.Below(b, entryThreshold(b)) || !size.Below(c, nil) {
+		t.Error("unexpected entries below entry thresholds")
+	}
+
+	log.Println("TestOrderings finished")
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"container/heap"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	fsnotify "github.com/fsnotify/fsnotify"
+)
+
+const (
+	POLL_TICK        time.Duration = time.Second
+	POLL_MININTERVAL time.Duration = 2 * time.Second
+	POLL_MAXINTERVAL time.Duration = 10 * time.Minute
+	POLL_RATE        int           = 2000
+	POLL_FILEPARTS   int           = 6
+)
+
+type pollItem struct {
+	direntry   *DirEntry
+	due        time.Time
+	lastchange time.Time
+	changes    int
+	offset     int
+	index      int
+}
+
+type pollQueue []*pollItem
+
+func (queue pollQueue) Len() int           { return len(queue) }
+func (queue pollQueue) Less(i, j int) bool { return queue[i].due.Before(queue[j].due) }
+func (queue pollQueue) Swap(i, j int) {
+	queue[i], queue[j] = queue[j], queue[i]
+	queue[i].index = i
+	queue[j].index = j
+}
+
+func (queue *pollQueue) Push(x interface{}) {
+	item := x.(*pollItem)
+	item.index = len(*queue)
+	*queue = append(*queue, item)
+}
+
+func (queue *pollQueue) Pop() interface{} {
+	old := *queue
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*queue = old[:len(old)-1]
+	item.index = -1
+	return item
+}
+
+// - the longer ago a directory changed the less likely it is to change soon, and directories that
+// changed often are likely to change again, so we poll recent and busy directories more often, but
+// never more often then POLL_MININTERVAL and never less often then POLL_MAXINTERVAL
+func pollInterval(lastchange time.Time, changes int, now time.Time) time.Duration {
+	interval := now.Sub(lastchange) / 16 / time.Duration(1+changes)
+	if interval < POLL_MININTERVAL {
+		interval = POLL_MININTERVAL
+	} else if interval > POLL_MAXINTERVAL {
+		interval = POLL_MAXINTERVAL
+	}
+	return interval
+}
+
+// - schedules polling of all directories that are not watched with inotify, directories are kept in a
+// priority queue ordered by when they are due next, and every call to Poll only stats as many
+// directories and files as the budget allows
+type Poller struct {
+	mutex sync.Mutex
+	queue pollQueue
+	items map[*DirEntry]*pollItem
+	rate  int
+}
+
+func NewPoller(rate int) *Poller {
+	if rate <= 0 {
+		rate = POLL_RATE
+	}
+
+	return &Poller{
+		items: make(map[*DirEntry]*pollItem),
+		rate:  rate,
+	}
+}
+
+func (poller *Poller) Len() int {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	return len(poller.queue)
+}
+
+// - watched directories are added as well, they are skipped while they are watched, but when they are
+// demoted to polling they are already scheduled
+func (poller *Poller) Add(direntry *DirEntry, now time.Time) {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+
+	if _, ok := poller.items[direntry]; ok {
+		return
+	}
+
+	lastchange := direntry.modtime
+	for _, entry := range direntry.files {
+		if entry.modtime.After(lastchange) {
+			lastchange = entry.modtime
+		}
+	}
+
+	item := &pollItem{
+		direntry:   direntry,
+		lastchange: lastchange,
+		due:        now.Add(pollInterval(lastchange, 0, now)),
+	}
+	poller.items[direntry] = item
+	heap.Push(&poller.queue, item)
+}
+
+// - polls due directories until budget stats are used up, directories that are not in direntries
+// anymore are dropped, changes are queued as events just like inotify events, returns the number
+// of stats used
+func (poller *Poller) Poll(direntries *sync.Map, eventqueue *sync.Map, now time.Time, budget int) int {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+
+	used := 0
+	for used < budget && len(poller.queue) > 0 && !poller.queue[0].due.After(now) {
+		item := heap.Pop(&poller.queue).(*pollItem)
+		direntry := item.direntry
+
+		if current, ok := direntries.Load(direntry.path); !ok || current.(*DirEntry) != direntry {
+			delete(poller.items, direntry)
+			continue
+		}
+
+		if direntry.inotify {
+			item.due = now.Add(POLL_MAXINTERVAL)
+			heap.Push(&poller.queue, item)
+			continue
+		}
+
+		changed := false
+		dirinfo, statdirerr := statDir(direntry)
+		used += 1
+
+		if statdirerr != nil {
+			queueEvent(eventqueue, direntry.path, dirinfo, fsnotify.Remove)
+			changed = true
+		} else if dirinfo.ModTime().After(direntry.modtime) {
+			queueEvent(eventqueue, direntry.path, dirinfo, fsnotify.Write)
+			changed = true
+		} else if len(direntry.files) > 0 {
+			// - changing a file does not change the modtime of its directory, so every time a directory
+			// is polled we also stat a part of its files, after POLL_FILEPARTS polls all files were checked
+			stripe := (len(direntry.files) + POLL_FILEPARTS - 1) / POLL_FILEPARTS
+			for i := 0; i < stripe && used < budget; i++ {
+				if item.offset >= len(direntry.files) {
+					item.offset = 0
+				}
+				fileentry := direntry.files[item.offset]
+				item.offset += 1
+
+				filepath := path.Join(fileentry.Dir(), fileentry.name)
+				fileinfo, statfileerr := os.Lstat(filepath)
+				used += 1
+
+				if statfileerr != nil {
+					queueEvent(eventqueue, filepath, fileinfo, fsnotify.Remove)
+					changed = true
+					break
+				} else if fileinfo.ModTime().After(fileentry.modtime) {
+					queueEvent(eventqueue, direntry.path, dirinfo, fsnotify.Write)
+					changed = true
+					break
+				}
+			}
+		}
+
+		if changed {
+			item.changes += 1
+			item.lastchange = now
+		} else if item.changes > 0 {
+			item.changes /= 2
+		}
+
+		if direntry.modtime.After(item.lastchange) {
+			item.lastchange = direntry.modtime
+		}
+
+		item.due = now.Add(pollInterval(item.lastchange, item.changes, now))
+		heap.Push(&poller.queue, item)
+	}
+
+	return used
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"testing"
+)
+
+func TestPollInterval(t *testing.T) {
+	now := time.Now()
+
+	if pollInterval(now, 0, now) != POLL_MININTERVAL {
+		t.Error("a directory that just changed should be polled with POLL_MININTERVAL")
+	}
+
+	if pollInterval(now.Add(-24*365*time.Hour), 0, now) != POLL_MAXINTERVAL {
+		t.Error("a directory that did not change for a year should be polled with POLL_MAXINTERVAL")
+	}
+
+	recent := pollInterval(now.Add(-time.Hour), 0, now)
+	old := pollInterval(now.Add(-2*time.Hour), 0, now)
+	busy := pollInterval(now.Add(-time.Hour), 3, now)
+	if !(busy < recent && recent < old) {
+		t.Error("expected busy < recent < old, got", busy, recent, old)
+	}
+
+	log.Println("TestPollInterval finished")
+}
+
+func TestPoller(t *testing.T) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	now := time.Now()
+	direntries := new(sync.Map)
+	eventqueue := new(sync.Map)
+	poller := NewPoller(0)
+
+	var all []*DirEntry
+	for _, name := range []string{"busy", "idle", "watched"} {
+		dir := path.Join(root, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(dir, "file"), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		direntry := &DirEntry{path: dir}
+		dirinfo, fileentries, _, err := readDir(nil, nil, nil, direntry)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		direntry.modtime, direntry.files = dirinfo.ModTime(), fileentries
+		direntries.Store(dir, direntry)
+		all = append(all, direntry)
+	}
+	busy, idle, watched := all[0], all[1], all[2]
+	watched.inotify = true
+
+	// - pretend idle has not changed for a year
+	idle.modtime = now.Add(-24 * 365 * time.Hour)
+	idle.files[0].modtime = idle.modtime
+
+	for _, direntry := range all {
+		poller.Add(direntry, now)
+	}
+
+	if used := poller.Poll(direntries, eventqueue, now, 100); used != 0 {
+		t.Error("nothing should be due yet, but", used, "stats were used")
+	}
+
+	// - only busy is due after POLL_MININTERVAL, it is polled with one stat for the directory and one
+	// for its file
+	if used := poller.Poll(direntries, eventqueue, now.Add(POLL_MININTERVAL), 100); used != 2 {
+		t.Error("expected 2 stats for busy, got", used)
+	}
+
+	// - the budget limits how many stats are done, even if more directories are due
+	if used := poller.Poll(direntries, eventqueue, now.Add(2*POLL_MAXINTERVAL), 1); used != 1 {
+		t.Error("expected the budget of 1 stat to be used, got", used)
+	}
+
+	if err := ioutil.WriteFile(path.Join(busy.path, "new"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	busy.modtime = busy.modtime.Add(-time.Second)
+	if err := os.Remove(path.Join(idle.path, "file")); err != nil {
+		t.Fatal(err)
+	}
+	// - removing the file changes the modtime of idle, pretend it didn't so that the file is found missing
+	idle.modtime = time.Now().Add(time.Hour)
+
+	poller.Poll(direntries, eventqueue, now.Add(4*POLL_MAXINTERVAL), 100)
+
+	if _, ok := eventqueue.Load(busy.path); !ok {
+		t.Error("expected an event for the changed directory busy")
+	}
+	if _, ok := eventqueue.Load(path.Join(idle.path, "file")); !ok {
+		t.Error("expected an event for the removed file in idle")
+	}
+	if _, ok := eventqueue.Load(watched.path); ok {
+		t.Error("watched directories should not be polled")
+	}
+
+	direntries.Delete(busy.path)
+	poller.Poll(direntries, eventqueue, now.Add(8*POLL_MAXINTERVAL), 100)
+	if poller.Len() != 2 {
+		t.Error("removed directory busy should have been dropped from the poller")
+	}
+
+	log.Println("TestPoller finished")
+}
@@ -4,48 +4,88 @@ import (
 	"sort"
 )
 
-type SortColumn int
+// - sort.Interface for entries in the order of sortcolumn
+type SortedEntries struct {
+	less    func(a, b *FileEntry) bool
+	entries []*FileEntry
+}
 
-const (
-	SORT_BY_NAME SortColumn = iota
-	SORT_BY_DIR
-	SORT_BY_MODTIME
-	SORT_BY_SIZE
-)
+func SortedBy(sortcolumn SortColumn, entries []*FileEntry) SortedEntries {
+	return SortedEntries{orderings[sortcolumn].less, entries}
+}
+
+func (sorted SortedEntries) Len() int {
+	return len(sorted.entries)
+}
+
+func (sorted SortedEntries) Swap(i, j int) {
+	sorted.entries[i], sorted.entries[j] = sorted.entries[j], sorted.entries[i]
+}
+
+func (sorted SortedEntries) Less(i, j int) bool {
+	return sorted.less(sorted.entries[i], sorted.entries[j])
+}
+
+func sortFileEntries(sortcolumn SortColumn, files []*FileEntry) {
+	sort.Stable(SortedBy(sortcolumn, files))
+}
 
-type SortedByName []*FileEntry
+// - sort.Interface for the ids of entries in a column
+type SortedIds struct {
+	less func(a, b EntryId) bool
+	ids  []EntryId
+}
 
-func (entries SortedByName) Len() int      { return len(entries) }
-func (entries SortedByName) Swap(i, j int) { entries[i], entries[j] = entries[j], entries[i] }
-func (entries SortedByName) Less(i, j int) bool {
-	return entries[i].name < entries[j].name
+func (sorted SortedIds) Len() int {
+	return len(sorted.ids)
 }
 
-type SortedByDir []*FileEntry
+func (sorted SortedIds) Swap(i, j int) {
+	sorted.ids[i], sorted.ids[j] = sorted.ids[j], sorted.ids[i]
+}
 
-func (entries SortedByDir) Len() int      { return len(entries) }
-func (entries SortedByDir) Swap(i, j int) { entries[i], entries[j] = entries[j], entries[i] }
-func (entries SortedByDir) Less(i, j int) bool {
-	return entries[i].dir[1:] < entries[j].dir[1:]
+func (sorted SortedIds) Less(i, j int) bool {
+	return sorted.less(sorted.ids[i], sorted.ids[j])
 }
 
-type SortedByModTime []*FileEntry
+func sortEntryIds(table *EntryTable, sortcolumn SortColumn, ids []EntryId) {
+	sort.Sort(SortedIds{table.Less(sortcolumn), ids})
+}
 
-func (entries SortedByModTime) Len() int      { return len(entries) }
-func (entries SortedByModTime) Swap(i, j int) { entries[i], entries[j] = entries[j], entries[i] }
-func (entries SortedByModTime) Less(i, j int) bool {
-	return entries[i].modtime.After(entries[j].modtime)
+func lessFileEntries(sortcolumn SortColumn, a, b *FileEntry) bool {
+	return orderings[sortcolumn].less(a, b)
 }
 
-type SortedBySize []*FileEntry
+// - binary search for the first entry in sorted that is not less then entry, then walk the run of
+// entries that compare equal to find the one with the same dir and name, entries that are already
+// marked in skip are ignored so that the same index is not found twice
+// - the orderings are total, so the run only ever has more then one entry when the same file was
+// merged more then once
+// - returns -1 if entry is not in sorted
+func searchFileEntry(table *EntryTable, sortcolumn SortColumn, sorted []EntryId, entry *FileEntry, skip map[int]bool) int {
+	first := sort.Search(len(sorted), func(i int) bool {
+		return !lessFileEntries(sortcolumn, table.Get(sorted[i]), entry)
+	})
+
+	for i := first; i < len(sorted) && !lessFileEntries(sortcolumn, entry, table.Get(sorted[i])); i++ {
+		if other := table.Get(sorted[i]); !skip[i] && other.Dir() == entry.Dir() && other.name == entry.name {
+			return i
+		}
+	}
 
-func (entries SortedBySize) Len() int      { return len(entries) }
-func (entries SortedBySize) Swap(i, j int) { entries[i], entries[j] = entries[j], entries[i] }
-func (entries SortedBySize) Less(i, j int) bool {
-	return entries[i].size > entries[j].size
+	return -1
 }
 
 func sortMerge(sortcolumn SortColumn, left, right []*FileEntry) []*FileEntry {
+	return mergeSorted(orderings[sortcolumn].less, left, right)
+}
+
+func sortMergeIds(table *EntryTable, sortcolumn SortColumn, left, right []EntryId) []EntryId {
+	return mergeSorted(table.Less(sortcolumn), left, right)
+}
+
+// - merges two slices that are sorted by less, it works on entries and on the ids of entries in the columns
+func mergeSorted[E any](less func(a, b E) bool, left, right []E) []E {
 	if len(left) == 0 {
 		return right
 	}
@@ -54,45 +94,13 @@ func sortMerge(sortcolumn SortColumn, left, right []*FileEntry) []*FileEntry {
 		return left
 	}
 
-	// BEGIN VERSION 0
-	// left = append(left, right...)
-	// switch sortcolumn {
-	// case SORT_BY_NAME:
-	// 	sort.Stable(SortedByName(left))
-	// case SORT_BY_MODTIME:
-	// 	sort.Stable(SortedByModTime(left))
-	// case SORT_BY_SIZE:
-	// 	sort.Stable(SortedBySize(left))
-	// }
-	// return left
-	// END VERSION 0
-
-	// - I want to use the sort.Interface functions that I defined above for SortedByName, etc, so
-	// I had to come up with this convoluted way to use them to compare elements from two different
-	// slices, I make a small slice of only the two elements I want to compare, then call Less with
-	// 0 and 1 as indices
-	testRightBeforeLeft, testLeftBeforeRight := false, false
-	xs := []*FileEntry{right[len(right)-1], left[0]}
-	ys := []*FileEntry{left[len(left)-1], right[0]}
-	switch sortcolumn {
-	case SORT_BY_NAME:
-		testRightBeforeLeft = SortedByName(xs).Less(0, 1)
-		testLeftBeforeRight = SortedByName(ys).Less(0, 1)
-	case SORT_BY_DIR:
-		testRightBeforeLeft = SortedByDir(xs).Less(0, 1)
-		testLeftBeforeRight = SortedByDir(ys).Less(0, 1)
-	case SORT_BY_MODTIME:
-		testRightBeforeLeft = SortedByModTime(xs).Less(0, 1)
-		testLeftBeforeRight = SortedByModTime(ys).Less(0, 1)
-	case SORT_BY_SIZE:
-		testRightBeforeLeft = SortedBySize(xs).Less(0, 1)
-		testLeftBeforeRight = SortedBySize(ys).Less(0, 1)
-	}
+	testRightBeforeLeft := less(right[len(right)-1], left[0])
+	testLeftBeforeRight := less(left[len(left)-1], right[0])
 
 	// - first two conditions are just early out if the two slices to merge happen to be
 	// completely in front or behind each other, then we can just append them and are done
 	// - this is so rare it might make sense to just not test it at all
-	var result []*FileEntry
+	var result []E
 	if testRightBeforeLeft { //less(right, len(right)-1, left, 0)
 		//result = append(right, left...)
 		result = right
@@ -102,25 +110,14 @@ func sortMerge(sortcolumn SortColumn, left, right []*FileEntry) []*FileEntry {
 		result = left
 		result = append(result, right...)
 	} else {
-		resultmem := make([]*FileEntry, len(left)+len(right))
+		resultmem := make([]E, len(left)+len(right))
 		result = resultmem[:0]
 
-		// - append left and right together into queue, then operate only using indices into queue,
-		// that way I can reuse the above sort.Interface functions
+		// - append left and right together into queue, then operate only using indices into queue
 		// - notice that queue will stay the same throughout the whole process, the merging is done
 		// by building the merged slice in result by appending elements from queue to result, queue
-		// is only used to compare elements with the sort.Interface Less function
-		var queue sort.Interface
-		switch sortcolumn {
-		case SORT_BY_NAME:
-			queue = SortedByName(append(left, right...))
-		case SORT_BY_DIR:
-			queue = SortedByDir(append(left, right...))
-		case SORT_BY_MODTIME:
-			queue = SortedByModTime(append(left, right...))
-		case SORT_BY_SIZE:
-			queue = SortedBySize(append(left, right...))
-		}
+		// is only used to compare elements
+		queue := append(left, right...)
 
 		// - these are the indices we'll need, leftqueue marks the start of the (remaining) left slice in
 		// queue, rightqueue marks the start of the (remaining) right slice in queue, and rightindex marks
@@ -148,7 +145,7 @@ func sortMerge(sortcolumn SortColumn, left, right []*FileEntry) []*FileEntry {
 			// element of the left slice in the queue, this construct returns the smallest index where
 			// the first element of the right slice is less then an element of the left slice as foundindex
 			foundindex := sort.Search(n, func(testindex int) bool {
-				return queue.Less(rightqueue, leftqueue+testindex)
+				return less(queue[rightqueue], queue[leftqueue+testindex])
 			})
 
 			// - when the found index is n then the remaining right slice lies completely behind the remaining
@@ -175,11 +172,10 @@ func sortMerge(sortcolumn SortColumn, left, right []*FileEntry) []*FileEntry {
 			// then the element at foundindex, increase rightindex AND rightqueue by one each time because
 			// we need to keep track of the position of the right slice in queue AND where we are in the
 			// right slice (the one outside of queue) because we have to take elements from that one when
-			// appending (we can't use the [] operator on queue because its type is sort.Interface, so we
-			// use right[rightindex] instead)
+			// appending
 			// - append until either an element is not less then the element at foundindex, or the whole
 			// right slice has been appended
-			for rightindex < len(right) && queue.Less(rightqueue, leftqueue+foundindex) {
+			for rightindex < len(right) && less(queue[rightqueue], queue[leftqueue+foundindex]) {
 				result = append(result, right[rightindex])
 				rightindex += 1
 				rightqueue += 1
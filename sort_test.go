@@ -23,10 +23,10 @@ func getDirectoryFiles(dirs []string) []*FileEntry {
 						log.Println("Could not read file:", err)
 					} else {
 						files = append(files, &FileEntry{
-							dir:     dir,
-							name:    fileinfo.Name(),
-							modtime: fileinfo.ModTime(),
-							size:    fileinfo.Size(),
+							direntry: &DirEntry{path: dir},
+							name:     fileinfo.Name(),
+							modtime:  fileinfo.ModTime(),
+							size:     fileinfo.Size(),
 						})
 					}
 				}
@@ -44,21 +44,26 @@ func getDirectoryFiles(dirs []string) []*FileEntry {
 func TestSort(t *testing.T) {
 	files := getDirectoryFiles([]string{"/tmp"})
 
-	sort.Stable(SortedByName(files))
-	if !sort.IsSorted(SortedByName(files)) {
+	sort.Stable(SortedBy(SORT_BY_NAME, files))
+	if !sort.IsSorted(SortedBy(SORT_BY_NAME, files)) {
 		t.Error("Not sorted by name!")
 	}
 
-	sort.Stable(SortedByModTime(files))
-	if !sort.IsSorted(SortedByModTime(files)) {
+	sort.Stable(SortedBy(SORT_BY_MODTIME, files))
+	if !sort.IsSorted(SortedBy(SORT_BY_MODTIME, files)) {
 		t.Error("Not sorted by modtime!")
 	}
 
-	sort.Stable(SortedBySize(files))
-	if !sort.IsSorted(SortedBySize(files)) {
+	sort.Stable(SortedBy(SORT_BY_SIZE, files))
+	if !sort.IsSorted(SortedBy(SORT_BY_SIZE, files)) {
 		t.Error("Not sorted by size!")
 	}
 
+	sort.Stable(SortedBy(SORT_BY_EXTENSION, files))
+	if !sort.IsSorted(SortedBy(SORT_BY_EXTENSION, files)) {
+		t.Error("Not sorted by extension!")
+	}
+
 	log.Println("TestSort finished")
 }
 
@@ -69,7 +74,7 @@ func BenchmarkSortedByName(b *testing.B) {
 
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
-		sort.Stable(SortedByName(files))
+		sort.Stable(SortedBy(SORT_BY_NAME, files))
 	}
 }
 
@@ -80,7 +85,7 @@ func BenchmarkSortedByDir(b *testing.B) {
 
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
-		sort.Stable(SortedByDir(files))
+		sort.Stable(SortedBy(SORT_BY_DIR, files))
 	}
 }
 
@@ -91,7 +96,7 @@ func BenchmarkSortedByModTime(b *testing.B) {
 
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
-		sort.Stable(SortedByModTime(files))
+		sort.Stable(SortedBy(SORT_BY_MODTIME, files))
 	}
 }
 
@@ -102,7 +107,7 @@ func BenchmarkSortedBySize(b *testing.B) {
 
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
-		sort.Stable(SortedBySize(files))
+		sort.Stable(SortedBy(SORT_BY_SIZE, files))
 	}
 }
 
@@ -121,7 +126,7 @@ func TestSortMerge(t *testing.T) {
 
 		bynamefiles := make([]*FileEntry, len(files))
 		copy(bynamefiles, files)
-		sort.Stable(SortedByName(bynamefiles))
+		sort.Stable(SortedBy(SORT_BY_NAME, bynamefiles))
 		byname = sortMerge(SORT_BY_NAME, byname, bynamefiles)
 		if len(byname) < len(allfiles) {
 			t.Error("Result of sortMerge for SORT_BY_NAME contains less entries then its input", len(byname), len(allfiles))
@@ -129,7 +134,7 @@ func TestSortMerge(t *testing.T) {
 
 		bymodtimefiles := make([]*FileEntry, len(files))
 		copy(bymodtimefiles, files)
-		sort.Stable(SortedByModTime(bymodtimefiles))
+		sort.Stable(SortedBy(SORT_BY_MODTIME, bymodtimefiles))
 		bymodtime = sortMerge(SORT_BY_MODTIME, bymodtime, bymodtimefiles)
 		if len(bymodtime) < len(allfiles) {
 			t.Error("Result of sortMerge for SORT_BY_MODTIME contains less entries then its input", len(bymodtime), len(allfiles))
@@ -137,20 +142,20 @@ func TestSortMerge(t *testing.T) {
 
 		bysizefiles := make([]*FileEntry, len(files))
 		copy(bysizefiles, files)
-		sort.Stable(SortedBySize(bysizefiles))
+		sort.Stable(SortedBy(SORT_BY_SIZE, bysizefiles))
 		bysize = sortMerge(SORT_BY_SIZE, bysize, bysizefiles)
 		if len(bysize) < len(allfiles) {
 			t.Error("Result of sortMerge for SORT_BY_SIZE contains less entries then its input", len(bysize), len(allfiles))
 		}
 	}
 
-	if !sort.IsSorted(SortedByName(byname)) {
+	if !sort.IsSorted(SortedBy(SORT_BY_NAME, byname)) {
 		log.Println("---- byname ----")
 		for i, entry := range byname {
 			log.Println(i, "\t\t", entry.name)
 		}
-		log.Println("---- sort.Sort(SortedByName(byname)) ----")
-		sort.Sort(SortedByName(allfiles))
+		log.Println("---- sort.Sort(SortedBy(SORT_BY_NAME, byname)) ----")
+		sort.Sort(SortedBy(SORT_BY_NAME, allfiles))
 		for i, entry := range allfiles {
 			log.Println(i, "\t\t", entry.name)
 		}
@@ -158,11 +163,11 @@ func TestSortMerge(t *testing.T) {
 		t.Error("Not sorted by name after merging")
 	}
 
-	if !sort.IsSorted(SortedByModTime(bymodtime)) {
+	if !sort.IsSorted(SortedBy(SORT_BY_MODTIME, bymodtime)) {
 		t.Error("Not sorted by modtime after merging")
 	}
 
-	if !sort.IsSorted(SortedBySize(bysize)) {
+	if !sort.IsSorted(SortedBy(SORT_BY_SIZE, bysize)) {
 		t.Error("Not sorted by size after merging")
 	}
 
@@ -193,20 +198,8 @@ func BenchmarkSortMerge(b *testing.B) {
 		var cache [][]*FileEntry
 		for _, dir := range directories {
 			files := getDirectoryFiles([]string{dir})
-			switch bm.sorting {
-			case SORT_BY_NAME:
-				sort.Stable(SortedByName(files))
-				cache = append(cache, files)
-			case SORT_BY_DIR:
-				sort.Stable(SortedByDir(files))
-				cache = append(cache, files)
-			case SORT_BY_MODTIME:
-				sort.Stable(SortedByModTime(files))
-				cache = append(cache, files)
-			case SORT_BY_SIZE:
-				sort.Stable(SortedBySize(files))
-				cache = append(cache, files)
-			}
+			sortFileEntries(bm.sorting, files)
+			cache = append(cache, files)
 		}
 		b.Run(bm.name, func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// - counters that are updated by all the goroutines of the crawler, all methods can be called on
+// a nil *CrawlStats so that functions like visit can be used without keeping statistics
+type CrawlStats struct {
+	started     time.Time
+	queued      int64
+	visited     int64
+	directories int64
+	files       int64
+	bytes       int64
+	duplicates  int64
+	errors      *CrawlErrors
+	done        int32
+}
+
+// - a snapshot of CrawlStats that is published by the crawler
+type CrawlProgress struct {
+	queued      int64
+	visited     int64
+	directories int64
+	files       int64
+	bytes       int64
+	errors      int64
+	watched     int64
+	polled      int64
+	remaining   int64
+	eta         time.Duration
+	done        bool
+}
+
+func NewCrawlStats(crawlerrors *CrawlErrors) *CrawlStats {
+	return &CrawlStats{started: time.Now(), errors: crawlerrors}
+}
+
+func (stats *CrawlStats) Queued() {
+	if stats != nil {
+		atomic.AddInt64(&stats.queued, 1)
+	}
+}
+
+func (stats *CrawlStats) Visited() {
+	if stats != nil {
+		atomic.AddInt64(&stats.visited, 1)
+	}
+}
+
+func (stats *CrawlStats) Directories(n int) {
+	if stats != nil {
+		atomic.AddInt64(&stats.directories, int64(n))
+	}
+}
+
+func (stats *CrawlStats) Indexed(files []*FileEntry) {
+	if stats != nil {
+		var bytes int64
+		for _, entry := range files {
+			bytes += entry.size
+		}
+		atomic.AddInt64(&stats.files, int64(len(files)))
+		atomic.AddInt64(&stats.bytes, bytes)
+	}
+}
+
+func (stats *CrawlStats) Unindexed(files []*FileEntry) {
+	if stats != nil {
+		var bytes int64
+		for _, entry := range files {
+			bytes += entry.size
+		}
+		atomic.AddInt64(&stats.files, -int64(len(files)))
+		atomic.AddInt64(&stats.bytes, -bytes)
+	}
+}
+
+// - bytes of files that were indexed under more than one path, see Aliases
+func (stats *CrawlStats) Duplicates(bytes int64) {
+	if stats != nil {
+		atomic.AddInt64(&stats.duplicates, bytes)
+	}
+}
+
+func (stats *CrawlStats) Error(path string, op string, err error) {
+	if stats != nil {
+		stats.errors.Add(path, op, err)
+	}
+}
+
+func (stats *CrawlStats) Clear(path string) {
+	if stats != nil {
+		stats.errors.Clear(path)
+	}
+}
+
+func (stats *CrawlStats) Done() {
+	if stats != nil {
+		atomic.StoreInt32(&stats.done, 1)
+	}
+}
+
+// - the estimated time until the crawl is done is extrapolated from how many directories we visited
+// per second so far, the number of remaining directories grows while we find new ones, so this is
+// only a rough estimate
+func (stats *CrawlStats) Progress(watched int, now time.Time) CrawlProgress {
+	progress := CrawlProgress{
+		queued:      atomic.LoadInt64(&stats.queued),
+		visited:     atomic.LoadInt64(&stats.visited),
+		directories: atomic.LoadInt64(&stats.directories),
+		files:       atomic.LoadInt64(&stats.files),
+		bytes:       atomic.LoadInt64(&stats.bytes) - atomic.LoadInt64(&stats.duplicates),
+		errors:      int64(stats.errors.Len()),
+		watched:     int64(watched),
+		done:        atomic.LoadInt32(&stats.done) != 0,
+	}
+
+	progress.polled = progress.directories - progress.watched
+	if progress.polled < 0 {
+		progress.polled = 0
+	}
+
+	progress.remaining = progress.queued - progress.visited
+	elapsed := now.Sub(stats.started)
+	if !progress.done && progress.visited > 0 && elapsed > 0 {
+		rate := float64(progress.visited) / elapsed.Seconds()
+		progress.eta = time.Duration(float64(progress.remaining) / rate * float64(time.Second))
+	}
+
+	return progress
+}
+
+func (progress CrawlProgress) String() string {
+	status := "crawling"
+	if progress.done {
+		status = "up to date"
+	}
+
+	text := fmt.Sprintf("%s: %d files (%s) in %d directories, %d watched, %d polled",
+		status, progress.files, formatSize(progress.bytes), progress.directories, progress.watched, progress.polled)
+
+	if !progress.done {
+		text += fmt.Sprintf(", %d/%d directories visited, %d remaining", progress.visited, progress.queued, progress.remaining)
+		if progress.eta > 0 {
+			text += fmt.Sprintf(", about %s left", progress.eta.Round(time.Second))
+		}
+	}
+
+	if progress.errors > 0 {
+		text += fmt.Sprintf(", %d errors", progress.errors)
+	}
+
+	return text
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"runtime"
+	"time"
+
+	"testing"
+)
+
+func TestCrawlStats(t *testing.T) {
+	var nilstats *CrawlStats
+	nilstats.Queued()
+	nilstats.Visited()
+	nilstats.Indexed([]*FileEntry{{size: 1}})
+	nilstats.Error("/a", "readdir", os.ErrPermission)
+	nilstats.Done()
+
+	stats := NewCrawlStats(NewCrawlErrors())
+	stats.started = time.Now().Add(-10 * time.Second)
+
+	files := []*FileEntry{{name: "a", size: 100}, {name: "b", size: 200}, {name: "c", size: 300}}
+	for i := 0; i < 4; i++ {
+		stats.Queued()
+	}
+	stats.Directories(4)
+	stats.Visited()
+	stats.Visited()
+	stats.Indexed(files)
+	stats.Unindexed(files[:1])
+	stats.Error("/a", "readdir", os.ErrPermission)
+
+	progress := stats.Progress(1, stats.started.Add(10*time.Second))
+	if progress.queued != 4 || progress.visited != 2 || progress.remaining != 2 {
+		t.Error("unexpected directory counts:", progress.queued, progress.visited, progress.remaining)
+	}
+	if progress.files != 2 || progress.bytes != 500 || progress.errors != 1 {
+		t.Error("unexpected file counts:", progress.files, progress.bytes, progress.errors)
+	}
+	if progress.watched != 1 || progress.polled != 3 {
+		t.Error("unexpected watched and polled counts:", progress.watched, progress.polled)
+	}
+
+	// - two directories in ten seconds, so the remaining two take another ten seconds
+	if progress.eta != 10*time.Second {
+		t.Error("unexpected eta:", progress.eta)
+	}
+
+	stats.Done()
+	progress = stats.Progress(1, time.Now())
+	if !progress.done || progress.eta != 0 {
+		t.Error("expected progress to be done without eta")
+	}
+
+	log.Println("TestCrawlStats finished")
+}
+
+func TestCrawlProgress(t *testing.T) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	numfiles := 0
+	for _, subdir := range []string{"a", "b", "b/c"} {
+		if err := os.Mkdir(path.Join(root, subdir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"1", "2"} {
+			if err := ioutil.WriteFile(path.Join(root, subdir, name), []byte("1234"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			numfiles += 1
+		}
+	}
+
+	mem := NewResultMemory()
+	config := Configuration{
+		cores:       runtime.NumCPU(),
+		directories: []string{root},
+		maxinotify:  1024,
+	}
+
+	progress := make(chan CrawlProgress)
+	crawler := startCrawler(testCrawler{mem: mem, config: config, progress: progress})
+	defer crawler.stop()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case current := <-progress:
+			if !current.done {
+				continue
+			}
+
+			if current.files != int64(numfiles) || current.bytes != int64(numfiles*4) {
+				t.Error("unexpected file counts:", current.files, current.bytes)
+			}
+			if current.directories != 4 || current.visited != 4 || current.remaining != 0 {
+				t.Error("unexpected directory counts:", current.directories, current.visited, current.remaining)
+			}
+			if current.watched+current.polled != current.directories {
+				t.Error("watched and polled directories do not add up:", current.watched, current.polled)
+			}
+
+			log.Println("TestCrawlProgress finished")
+			return
+		case <-timeout:
+			t.Fatal("crawler did not publish progress")
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"container/list"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+
+	fsnotify "github.com/fsnotify/fsnotify"
+)
+
+// - the kernel limit is shared by all processes of a user, so we only take half of it
+func readInotifyLimit() int {
+	limit := 8192
+
+	maxinotifybytes, readerr := ioutil.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+	if readerr == nil {
+		maxinotifystring := strings.TrimSpace(string(maxinotifybytes))
+
+		maxinotifyint64, converr := strconv.ParseUint(maxinotifystring, 10, 32)
+		if converr == nil {
+			limit = int(maxinotifyint64)
+		}
+	}
+
+	return limit / 2
+}
+
+// - keeps track of which directories are watched with inotify, ordered by when they last changed, so
+// that when we run out of watches we can demote the directory that has been idle the longest to polling
+// and promote a directory that turned out to change
+type Watches struct {
+	mutex    sync.Mutex
+	watcher  *fsnotify.Watcher
+	errors   *CrawlErrors
+	limit    int
+	lru      *list.List
+	elements map[string]*list.Element
+}
+
+func NewWatches(watcher *fsnotify.Watcher, limit int, crawlerrors *CrawlErrors) *Watches {
+	return &Watches{
+		watcher:  watcher,
+		errors:   crawlerrors,
+		limit:    limit,
+		lru:      list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+func (watches *Watches) Len() int {
+	watches.mutex.Lock()
+	defer watches.mutex.Unlock()
+	return watches.lru.Len()
+}
+
+// - start watching direntry if there are watches left, returns false if the directory is polled instead
+func (watches *Watches) Add(direntry *DirEntry) bool {
+	watches.mutex.Lock()
+	defer watches.mutex.Unlock()
+	return watches.add(direntry)
+}
+
+func (watches *Watches) add(direntry *DirEntry) bool {
+	if element, ok := watches.elements[direntry.path]; ok {
+		watches.lru.MoveToFront(element)
+		return true
+	}
+
+	// - directories on network filesystems are always polled, inotify does not see changes made by other machines
+	if direntry.forcepoll || watches.lru.Len() >= watches.limit {
+		return false
+	}
+
+	// - a directory we can't watch is polled instead, but we keep a record of why, running out of
+	// watches shows up here as ENOSPC when other processes use more watches than we expected
+	if err := watches.watcher.Add(direntry.path); err != nil {
+		watches.errors.Add(direntry.path, "inotify_add_watch", err)
+		return false
+	}
+
+	watches.elements[direntry.path] = watches.lru.PushFront(direntry)
+	direntry.inotify = true
+	return true
+}
+
+func (watches *Watches) Remove(direntry *DirEntry) {
+	watches.mutex.Lock()
+	defer watches.mutex.Unlock()
+	watches.remove(direntry)
+}
+
+func (watches *Watches) remove(direntry *DirEntry) {
+	element, ok := watches.elements[direntry.path]
+	if !ok {
+		return
+	}
+
+	// - inotify removes the watch by itself when a directory is deleted, so we ignore the error here
+	watches.watcher.Remove(direntry.path)
+	watches.lru.Remove(element)
+	delete(watches.elements, direntry.path)
+	element.Value.(*DirEntry).inotify = false
+	direntry.inotify = false
+}
+
+// - called whenever a directory changed, a watched directory becomes the most recently used one, a
+// polled directory is promoted to inotify, if necessary by demoting the least recently changed one
+func (watches *Watches) Promote(direntry *DirEntry) bool {
+	watches.mutex.Lock()
+	defer watches.mutex.Unlock()
+
+	if element, ok := watches.elements[direntry.path]; ok {
+		watches.lru.MoveToFront(element)
+		return true
+	}
+
+	if direntry.forcepoll {
+		return false
+	}
+
+	if watches.lru.Len() >= watches.limit && watches.lru.Len() > 0 {
+		watches.remove(watches.lru.Back().Value.(*DirEntry))
+	}
+
+	return watches.add(direntry)
+}
+
+// - the limit may change at runtime, when it shrinks we demote the least recently changed directories
+// until we are within the limit again
+func (watches *Watches) SetLimit(limit int) {
+	watches.mutex.Lock()
+	defer watches.mutex.Unlock()
+
+	watches.limit = limit
+	for watches.lru.Len() > watches.limit {
+		watches.remove(watches.lru.Back().Value.(*DirEntry))
+	}
+}
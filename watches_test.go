@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+
+	fsnotify "github.com/fsnotify/fsnotify"
+
+	"testing"
+)
+
+func TestWatches(t *testing.T) {
+	root, err := ioutil.TempDir("", "golocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	direntries := make(map[string]*DirEntry)
+	for _, name := range []string{"a", "b", "c"} {
+		dir := path.Join(root, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		direntries[name] = &DirEntry{path: dir}
+	}
+	a, b, c := direntries["a"], direntries["b"], direntries["c"]
+
+	watches := NewWatches(watcher, 2, nil)
+	if !watches.Add(a) || !watches.Add(b) {
+		t.Error("could not watch a and b")
+	}
+	if watches.Add(c) {
+		t.Error("watched c although there are no watches left")
+	}
+	if !a.inotify || !b.inotify || c.inotify {
+		t.Error("unexpected inotify flags after Add:", a.inotify, b.inotify, c.inotify)
+	}
+
+	// - a changed most recently, so b is the least recently changed directory and gets demoted
+	watches.Promote(a)
+	if !watches.Promote(c) {
+		t.Error("could not promote c")
+	}
+	if !a.inotify || b.inotify || !c.inotify {
+		t.Error("unexpected inotify flags after Promote:", a.inotify, b.inotify, c.inotify)
+	}
+
+	watches.SetLimit(1)
+	if watches.Len() != 1 || a.inotify || !c.inotify {
+		t.Error("unexpected inotify flags after SetLimit:", a.inotify, b.inotify, c.inotify)
+	}
+
+	watches.Remove(c)
+	if watches.Len() != 0 || c.inotify {
+		t.Error("c is still watched after Remove")
+	}
+
+	if readInotifyLimit() <= 0 {
+		t.Error("inotify limit should be positive")
+	}
+
+	log.Println("TestWatches finished")
+}